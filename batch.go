@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os/exec"
+	"strings"
+
+	"github.com/tamayika/gaq/pkg/gaq"
+)
+
+const (
+	batchNUL   = "nul"
+	batchJSONL = "jsonl"
+)
+
+// batchResult represents the replaced record returned from batch command in jsonl framing
+type batchResult struct {
+	Text *string `json:"text"`
+}
+
+// replaceByBatch spawns command once for matches of all files and returns replaced texts by match.
+// Command reads node texts from STDIN and writes replaced texts to STDOUT in the same framing.
+// In nul framing, each record is the node text terminated by NUL.
+// In jsonl framing, each record is the json match of `-f jsonl` output and replaced text is read from `text` field.
+func replaceByBatch(files []*sourceFile, fset *token.FileSet, fileMatches [][]*gaq.Match, commands []string, framing string) (map[*gaq.Match][]byte, error) {
+	var input bytes.Buffer
+	matches := []*gaq.Match{}
+	for i, f := range files {
+		for j, record := range buildMatches(f, fset, fileMatches[i]) {
+			switch framing {
+			case batchNUL:
+				input.WriteString(record.Text)
+				input.WriteByte(0)
+			case batchJSONL:
+				data, err := json.Marshal(record)
+				if err != nil {
+					return nil, err
+				}
+				input.Write(data)
+				input.WriteByte('\n')
+			default:
+				return nil, fmt.Errorf("batch framing %s is not supported", framing)
+			}
+			matches = append(matches, fileMatches[i][j])
+		}
+	}
+	if len(matches) == 0 {
+		return map[*gaq.Match][]byte{}, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(commands[0], commands[1:]...)
+	cmd.Stdin = &input
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("command failed.\nerr: %v\nstderr: %s", err, strings.TrimSuffix(stderr.String(), "\n"))
+	}
+	texts, err := splitBatchOutput(output, framing)
+	if err != nil {
+		return nil, err
+	}
+	if len(texts) != len(matches) {
+		return nil, fmt.Errorf("command returned %d records but %d records are expected", len(texts), len(matches))
+	}
+	replaced := map[*gaq.Match][]byte{}
+	for i, m := range matches {
+		replaced[m] = texts[i]
+	}
+	return replaced, nil
+}
+
+// splitBatchOutput splits command output to records.
+// In nul framing, every record including the last one must be terminated by NUL, so that empty records are not ambiguous.
+// In jsonl framing, empty lines are skipped and trailing newline is optional because each record is a JSON object.
+func splitBatchOutput(output []byte, framing string) ([][]byte, error) {
+	texts := [][]byte{}
+	if framing == batchNUL {
+		if len(output) == 0 {
+			return texts, nil
+		}
+		if output[len(output)-1] != 0 {
+			return nil, fmt.Errorf("record %d is not terminated by NUL", bytes.Count(output, []byte{0})+1)
+		}
+		return bytes.Split(output[:len(output)-1], []byte{0}), nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, len(output)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var result batchResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			return nil, fmt.Errorf("cannot parse record %d. %v", len(texts)+1, err)
+		}
+		if result.Text == nil {
+			return nil, fmt.Errorf("record %d has no text field", len(texts)+1)
+		}
+		texts = append(texts, []byte(*result.Text))
+	}
+	return texts, scanner.Err()
+}
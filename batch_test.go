@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBatchOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		framing string
+		want    []string
+		wantErr bool
+	}{
+		{"nul: empty output", "", batchNUL, []string{}, false},
+		{"nul: one record", "a\x00", batchNUL, []string{"a"}, false},
+		{"nul: one empty record", "\x00", batchNUL, []string{""}, false},
+		{"nul: two records", "a\x00b\x00", batchNUL, []string{"a", "b"}, false},
+		{"nul: empty last record", "a\x00\x00", batchNUL, []string{"a", ""}, false},
+		{"nul: record with newline", "a\nb\x00", batchNUL, []string{"a\nb"}, false},
+		{"nul: unterminated record", "a\x00b", batchNUL, nil, true},
+		{"nul: unterminated single record", "a", batchNUL, nil, true},
+		{"jsonl: empty output", "", batchJSONL, []string{}, false},
+		{"jsonl: one record", "{\"text\":\"a\"}\n", batchJSONL, []string{"a"}, false},
+		{"jsonl: one empty record", "{\"text\":\"\"}\n", batchJSONL, []string{""}, false},
+		{"jsonl: two records without trailing newline", "{\"text\":\"a\"}\n{\"text\":\"b\"}", batchJSONL, []string{"a", "b"}, false},
+		{"jsonl: empty lines are skipped", "{\"text\":\"a\"}\n\n{\"text\":\"\"}\n", batchJSONL, []string{"a", ""}, false},
+		{"jsonl: record without text", "{\"text\":\"a\"}\n{\"name\":\"b\"}\n", batchJSONL, nil, true},
+		{"jsonl: invalid record", "a\n", batchJSONL, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			texts, err := splitBatchOutput([]byte(tt.output), tt.framing)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			got := []string{}
+			for _, text := range texts {
+				got = append(got, string(text))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
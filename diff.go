@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// unifiedDiff returns unified diff between original and replaced source.
+// If there is no difference, empty string is returned.
+func unifiedDiff(name string, original []byte, replaced []byte) (string, error) {
+	if bytes.Equal(original, replaced) {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(original),
+		B:        splitLines(replaced),
+		FromFile: name + ".orig",
+		ToFile:   name,
+		Context:  3,
+	})
+}
+
+// splitLines splits source to lines keeping line endings.
+// If the last line has no line ending, `\ No newline at end of file` marker follows it like diff and gofmt -d.
+func splitLines(source []byte) []string {
+	lines := strings.SplitAfter(string(source), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n\\ No newline at end of file\n"
+	return lines
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		replaced string
+		want     string
+	}{
+		{
+			"Same",
+			"package a\n",
+			"package a\n",
+			"",
+		},
+		{
+			"Newline at end of file",
+			"package a\n\nvar X = 1\n",
+			"package a\n\nvar X = 2\n",
+			"--- a.go.orig\n+++ a.go\n@@ -1,3 +1,3 @@\n package a\n \n-var X = 1\n+var X = 2\n",
+		},
+		{
+			"No newline at end of both files",
+			"package a\n\nvar X = 1",
+			"package a\n\nvar X = 2",
+			"--- a.go.orig\n+++ a.go\n@@ -1,3 +1,3 @@\n package a\n \n-var X = 1\n\\ No newline at end of file\n+var X = 2\n\\ No newline at end of file\n",
+		},
+		{
+			"No newline at end of original",
+			"package a\n\nvar X = 1",
+			"package a\n\nvar X = 2\n",
+			"--- a.go.orig\n+++ a.go\n@@ -1,3 +1,3 @@\n package a\n \n-var X = 1\n\\ No newline at end of file\n+var X = 2\n",
+		},
+		{
+			"Unchanged last line without newline",
+			"var X = 1\nvar Y = 1",
+			"var X = 2\nvar Y = 1",
+			"--- a.go.orig\n+++ a.go\n@@ -1,2 +1,2 @@\n-var X = 1\n+var X = 2\n var Y = 1\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unifiedDiff("a.go", []byte(tt.original), []byte(tt.replaced))
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
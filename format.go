@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+
+	"golang.org/x/tools/imports"
+)
+
+// formatSource checks that rewritten source can be parsed, and formats it by gofmt or goimports if requested.
+// Imports are resolved from GOROOT, GOPATH and module cache without network access.
+func formatSource(name string, source []byte, edits []*edit, gofmt bool, fixImports bool) ([]byte, error) {
+	if _, err := parser.ParseFile(token.NewFileSet(), name, source, parser.ParseComments); err != nil {
+		return nil, rewriteError(source, edits, err)
+	}
+	if fixImports {
+		return processImports(name, source)
+	}
+	if gofmt {
+		return format.Source(source)
+	}
+	return source, nil
+}
+
+// processImports runs goimports with GOPROXY=off so that no module is downloaded.
+// GOPROXY is restored after that, so replace commands of later files inherit the environment of user.
+func processImports(name string, source []byte) ([]byte, error) {
+	proxy, hasProxy := os.LookupEnv("GOPROXY")
+	if err := os.Setenv("GOPROXY", "off"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if hasProxy {
+			os.Setenv("GOPROXY", proxy)
+		} else {
+			os.Unsetenv("GOPROXY")
+		}
+	}()
+	return imports.Process(name, source, &imports.Options{Comments: true, TabIndent: true, TabWidth: 8})
+}
+
+// rewriteError reports parse error of rewritten source with the replaced node which causes it.
+// The edit which contains the error position, or the last edit before it, is reported.
+func rewriteError(source []byte, edits []*edit, err error) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return fmt.Errorf("rewritten code does not parse. %v", err)
+	}
+	offset := list[0].Pos.Offset
+	var found *edit
+	for _, e := range edits {
+		if e.start > offset {
+			break
+		}
+		found = e
+	}
+	if found == nil {
+		return fmt.Errorf("rewritten code does not parse. %v", err)
+	}
+	return fmt.Errorf("rewritten code does not parse. %v\nnode: %s\noriginal: %s\nreplaced: %s", list[0], found.pos, found.original, source[found.start:found.end])
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessImports_RestoresGOPROXY(t *testing.T) {
+	source := []byte("package main\n\nfunc main() { fmt.Println() }\n")
+	want := "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println() }\n"
+
+	t.Setenv("GOPROXY", "https://proxy.example.com")
+	got, err := processImports("main.go", source)
+	if assert.NoError(t, err) {
+		assert.Equal(t, want, string(got))
+	}
+	assert.Equal(t, "https://proxy.example.com", os.Getenv("GOPROXY"))
+
+	os.Unsetenv("GOPROXY")
+	_, err = processImports("main.go", source)
+	assert.NoError(t, err)
+	_, ok := os.LookupEnv("GOPROXY")
+	assert.False(t, ok)
+}
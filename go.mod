@@ -1,11 +1,19 @@
 module github.com/tamayika/gaq
 
+go 1.25.0
+
 require (
 	github.com/alecthomas/participle v0.2.0
-	github.com/alecthomas/repr v0.0.0-20181024024818-d37bc2a10ba1
-	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/cobra v0.0.3
-	github.com/spf13/pflag v1.0.3 // indirect
 	github.com/stretchr/testify v1.2.2
-	golang.org/x/exp v0.0.0-20181112044915-a3060d491354 // indirect
+	golang.org/x/tools v0.47.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.3 // indirect
+	golang.org/x/mod v0.37.0 // indirect
+	golang.org/x/sync v0.21.0 // indirect
 )
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tamayika/gaq/pkg/gaq"
+)
+
+const stdinName = "<standard input>"
+
+// sourceFile represents parsed go source with its file name
+type sourceFile struct {
+	name   string
+	source []byte
+	file   *ast.File
+	// node is set when source is loaded with type information
+	node *gaq.Node
+}
+
+// root returns the root node of file
+func (f *sourceFile) root() *gaq.Node {
+	if f.node != nil {
+		return f.node
+	}
+	return gaq.MustParseNode(f.file)
+}
+
+// expandPaths expands files, directories and `dir/...` patterns to go file paths.
+// Directory lists go files directly under it, pattern walks directory recursively like go tool.
+func expandPaths(paths []string) ([]string, error) {
+	ret := []string{}
+	added := map[string]bool{}
+	add := func(path string) {
+		if _, ok := added[path]; !ok {
+			ret = append(ret, path)
+			added[path] = true
+		}
+	}
+	for _, path := range paths {
+		if path == "..." || strings.HasSuffix(path, "/...") {
+			root := strings.TrimSuffix(strings.TrimSuffix(path, "..."), "/")
+			if root == "" {
+				root = "."
+			}
+			err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					if p != root && isIgnoredDir(info.Name()) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if isGoFile(info) {
+					add(p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(path)
+			continue
+		}
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if !info.IsDir() && isGoFile(info) {
+				add(filepath.Join(path, info.Name()))
+			}
+		}
+	}
+	return ret, nil
+}
+
+func isIgnoredDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor"
+}
+
+func isGoFile(info os.FileInfo) bool {
+	name := info.Name()
+	return strings.HasSuffix(name, ".go") && !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "_")
+}
+
+// readSourceFiles reads and parses go files
+// If paths is empty, source is read from stdin
+func readSourceFiles(fset *token.FileSet, paths []string) ([]*sourceFile, error) {
+	if len(paths) == 0 {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseSourceFile(fset, stdinName, data)
+		if err != nil {
+			return nil, err
+		}
+		return []*sourceFile{f}, nil
+	}
+	filePaths, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	files := []*sourceFile{}
+	for _, path := range filePaths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseSourceFile(fset, path, data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// readTypedSourceFiles loads and type checks packages matched by patterns
+// If patterns is empty, the package in current directory is loaded
+func readTypedSourceFiles(fset *token.FileSet, patterns []string) ([]*sourceFile, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	pkgs, err := gaq.LoadPackages(fset, "", patterns...)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	files := []*sourceFile{}
+	for _, pkg := range pkgs {
+		for i, node := range pkg.Files {
+			name := pkg.Filenames[i]
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+				name = rel
+			}
+			files = append(files, &sourceFile{
+				name:   name,
+				source: data,
+				file:   node.Node.(*ast.File),
+				node:   node,
+			})
+		}
+	}
+	return files, nil
+}
+
+func parseSourceFile(fset *token.FileSet, name string, data []byte) (*sourceFile, error) {
+	f, err := parser.ParseFile(fset, name, data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceFile{
+		name:   name,
+		source: data,
+		file:   f,
+	}, nil
+}
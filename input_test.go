@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"a.go",
+		"a.txt",
+		"_a.go",
+		".a.go",
+		"b/b.go",
+		"b/c/c.go",
+		"testdata/t.go",
+		"vendor/v.go",
+		".git/g.go",
+		"_x/x.go",
+		"b/testdata/t.go",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755)) {
+			return
+		}
+		if !assert.NoError(t, os.WriteFile(path, []byte("package a\n"), 0644)) {
+			return
+		}
+	}
+	join := func(names ...string) []string {
+		paths := []string{}
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{"file", join("a.go"), join("a.go")},
+		{"ignored file is given explicitly", join("_a.go"), join("_a.go")},
+		{"directory", join(""), join("a.go")},
+		{"nested directory", join("b"), join("b/b.go")},
+		{"pattern", []string{dir + "/..."}, join("a.go", "b/b.go", "b/c/c.go")},
+		{"pattern of nested directory", []string{dir + "/b/..."}, join("b/b.go", "b/c/c.go")},
+		{"pattern of ignored directory", []string{dir + "/testdata/..."}, join("testdata/t.go")},
+		{"duplicated paths", append(join("a.go", "b"), dir+"/..."), join("a.go", "b/b.go", "b/c/c.go")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPaths(tt.paths)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+
+	t.Run("relative pattern", func(t *testing.T) {
+		wd, err := os.Getwd()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.Chdir(wd)
+		if !assert.NoError(t, os.Chdir(dir)) {
+			return
+		}
+		for _, pattern := range []string{"./...", "..."} {
+			got, err := expandPaths([]string{pattern})
+			if assert.NoError(t, err) {
+				assert.Equal(t, []string{"a.go", filepath.Join("b", "b.go"), filepath.Join("b", "c", "c.go")}, got)
+			}
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		_, err := expandPaths(join("not_exist.go"))
+		assert.Error(t, err)
+	})
+}
@@ -2,16 +2,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/token"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"strings"
+	"text/template"
 
 	"github.com/spf13/cobra"
 	"github.com/tamayika/gaq/pkg/gaq"
@@ -20,30 +20,165 @@ import (
 
 var version = "dev"
 
-func printText(source []byte, fset *token.FileSet, nodes []ast.Node) {
-	for _, node := range nodes {
-		pos := fset.Position(node.Pos())
-		end := fset.Position(node.End())
-		fmt.Println(string(source[pos.Offset:end.Offset]))
+func printText(f *sourceFile, fset *token.FileSet, matches []*gaq.Match, withName bool) {
+	for _, m := range matches {
+		pos := fset.Position(m.Node.Node.Pos())
+		end := fset.Position(m.Node.Node.End())
+		if withName {
+			fmt.Printf("%s:", f.name)
+		}
+		fmt.Println(string(f.source[pos.Offset:end.Offset]))
+	}
+}
+
+func printPos(f *sourceFile, fset *token.FileSet, matches []*gaq.Match) {
+	for _, m := range matches {
+		fmt.Println(formatPos(f.name, fset.Position(m.Node.Node.Pos()), fset.Position(m.Node.Node.End())))
+	}
+}
+
+// match represents matched node for json output
+type match struct {
+	Type     string            `json:"type"`
+	File     string            `json:"file"`
+	Start    position          `json:"start"`
+	End      position          `json:"end"`
+	Text     string            `json:"text"`
+	Path     []string          `json:"path"`
+	Captures map[string]string `json:"captures,omitempty"`
+}
+
+// position represents the position in file for json output
+type position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+func newPosition(p token.Position) position {
+	return position{
+		Line:   p.Line,
+		Column: p.Column,
+		Offset: p.Offset,
+	}
+}
+
+// buildMatches converts query matches to json matches. Path is the list of ancestor types from root.
+func buildMatches(f *sourceFile, fset *token.FileSet, queryMatches []*gaq.Match) []*match {
+	matches := []*match{}
+	for _, m := range queryMatches {
+		n := m.Node
+		pos := fset.Position(n.Node.Pos())
+		end := fset.Position(n.Node.End())
+		path := []string{}
+		for p := n.Parent; p != nil; p = p.Parent {
+			path = append([]string{p.Type}, path...)
+		}
+		matches = append(matches, &match{
+			Type:     n.Type,
+			File:     f.name,
+			Start:    newPosition(pos),
+			End:      newPosition(end),
+			Text:     string(f.source[pos.Offset:end.Offset]),
+			Path:     path,
+			Captures: captureValues(m),
+		})
+	}
+	return matches
+}
+
+// captureValues returns captured metavariable values by name, or nil if nothing is captured
+func captureValues(m *gaq.Match) map[string]string {
+	if len(m.Captures) == 0 {
+		return nil
 	}
+	values := map[string]string{}
+	for name, captured := range m.Captures {
+		values[name] = captured.Value
+	}
+	return values
 }
 
-func printPos(nodes []ast.Node) {
-	for _, node := range nodes {
-		fmt.Printf("%d,%d\n", node.Pos(), node.End())
+func printJSON(matches []*match) {
+	data, err := json.MarshalIndent(matches, "", "  ")
+	if err != nil {
+		log.Fatalf("Cannot marshal matches. %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+func printJSONL(matches []*match) {
+	for _, m := range matches {
+		data, err := json.Marshal(m)
+		if err != nil {
+			log.Fatalf("Cannot marshal match. %v", err)
+		}
+		fmt.Println(string(data))
 	}
 }
 
-func replaceByCommand(source []byte, fset *token.FileSet, nodes []ast.Node, commands []string) []byte {
+// formatPos formats range as `file:line:col-endline:endcol`
+func formatPos(name string, pos token.Position, end token.Position) string {
+	return fmt.Sprintf("%s:%d:%d-%d:%d", name, pos.Line, pos.Column, end.Line, end.Column)
+}
+
+// replaceFunc returns replaced text of matched node
+type replaceFunc func(m *gaq.Match, nodeText []byte) []byte
+
+// edit represents the replaced range in rewritten source
+type edit struct {
+	start int
+	end   int
+	// pos is the position of original node
+	pos      string
+	original []byte
+}
+
+// replaceNodes replaces text of matched nodes by the result of replace.
+// Matches must be sorted by position and must not overlap.
+func replaceNodes(source []byte, fset *token.FileSet, matches []*gaq.Match, replace replaceFunc) ([]byte, []*edit) {
 	ret := []byte{}
+	edits := []*edit{}
 	var lastNode ast.Node
-	for _, node := range nodes {
+	for _, m := range matches {
+		node := m.Node.Node
 		pos := fset.Position(node.Pos())
 		end := fset.Position(node.End())
 		nodeText := source[pos.Offset:end.Offset]
+		replacedText := replace(m, nodeText)
+		if lastNode == nil {
+			ret = append(ret, source[:pos.Offset]...)
+		} else {
+			ret = append(ret, source[fset.Position(lastNode.End()).Offset:pos.Offset]...)
+		}
+		edits = append(edits, &edit{
+			start:    len(ret),
+			end:      len(ret) + len(replacedText),
+			pos:      formatPos(pos.Filename, pos, end),
+			original: nodeText,
+		})
+		ret = append(ret, replacedText...)
+		lastNode = node
+	}
+	if lastNode == nil {
+		ret = source
+	} else {
+		ret = append(ret, source[fset.Position(lastNode.End()).Offset:]...)
+	}
+	return ret, edits
+}
+
+// replaceByCommand replaces matched node by the output of command which reads node text from STDIN.
+// Captured metavariables are passed to command as `GAQ_VAR_<name>` environment variables.
+func replaceByCommand(commands []string) replaceFunc {
+	return func(m *gaq.Match, nodeText []byte) []byte {
 		var stderr bytes.Buffer
 		cmd := exec.Command(commands[0], commands[1:]...)
 		cmd.Stderr = &stderr
+		cmd.Env = os.Environ()
+		for name, value := range captureValues(m) {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("GAQ_VAR_%s=%s", name, value))
+		}
 		stdin, err := cmd.StdinPipe()
 		if err != nil {
 			log.Fatalf("Cannot get stdin pipe. %v", err)
@@ -54,74 +189,198 @@ func replaceByCommand(source []byte, fset *token.FileSet, nodes []ast.Node, comm
 		if err != nil {
 			log.Fatalf("Command failed.\nerr: %v\nstderr: %s\nnodeText: %s", err, strings.TrimSuffix(string(stderr.String()), "\n"), string(nodeText))
 		}
-		if lastNode == nil {
-			ret = append(ret, source[:pos.Offset]...)
-		} else {
-			ret = append(ret, source[fset.Position(lastNode.End()).Offset:pos.Offset]...)
-		}
-		ret = append(ret, replacedText...)
-		lastNode = node
+		return replacedText
 	}
-	if lastNode == nil {
-		ret = source
-	} else {
-		ret = append(ret, source[fset.Position(lastNode.End()).Offset:]...)
+}
+
+// splitArgs splits args to paths and replace commands.
+// If command is expected, args after `--` are command. If `--` is omitted, all args after query are command.
+func splitArgs(args []string, argsLenAtDash int, hasCommand bool) ([]string, []string) {
+	if !hasCommand {
+		return args[1:], nil
 	}
-	return ret
+	if argsLenAtDash < 0 {
+		return nil, args[1:]
+	}
+	return args[1:argsLenAtDash], args[argsLenAtDash:]
 }
 
 func main() {
 	var format string
 	var mode string
+	var write bool
+	var diff bool
+	var typed bool
+	var pattern bool
+	var templateText string
+	var batch string
+	var overlap string
+	var gofmt bool
+	var fixImports bool
 
 	rootCmd := &cobra.Command{
-		Use:   "gaq <Query>",
-		Short: "gaq is the cli tool to query ast node. STDIN needed as go code.",
+		Use:   "gaq <Query> [paths...]",
+		Short: "gaq is the cli tool to query ast node. Go files or STDIN needed as go code.",
 		Long: `gaq is the cli tool to query ast node. 
 Typical usage is
 
   cat <go file path> | gaq <Query>
   cat <go file path> | gaq -m replace <Query> <Replace command>
+  gaq <Query> [files, directories or ./... patterns]
+  gaq -p <Go code pattern> [paths...]
+  gaq -m replace <Query> [paths...] -- <Replace command>
+  gaq -m replace --template <Template> <Query> [paths...]
 
 Please see details at https://github.com/tamayika/gaq`,
 		Args:    cobra.MinimumNArgs(1),
 		Version: version,
 		Run: func(cmd *cobra.Command, args []string) {
-			data, err := ioutil.ReadAll(os.Stdin)
-			if err != nil {
-				log.Fatalf("Cannot read data from stdin. %v", err)
+			var q *query.Query
+			if pattern {
+				q = query.MustParsePattern(args[0])
+			} else {
+				q = query.MustParse(args[0])
+			}
+			if write && mode != "replace" {
+				log.Fatalf("Write is available only in replace mode.")
+			}
+			if templateText != "" && mode != "replace" {
+				log.Fatalf("Template is available only in replace mode.")
+			}
+			var tmpl *template.Template
+			if templateText != "" {
+				var err error
+				tmpl, err = parseTemplate(templateText)
+				if err != nil {
+					log.Fatalf("Cannot parse template. %v", err)
+				}
+			}
+			if batch != "" && (mode != "replace" || tmpl != nil) {
+				log.Fatalf("Batch is available only in replace mode with command.")
+			}
+			if overlap == overlapInnermost && (batch != "" || typed) {
+				log.Fatalf("Overlap policy %s is not available with batch or types flag.", overlap)
+			}
+			paths, commands := splitArgs(args, cmd.ArgsLenAtDash(), mode == "replace" && tmpl == nil)
+			if mode == "replace" && tmpl == nil && len(commands) == 0 {
+				log.Fatalf("One or more command and args or template are expected in replace mode.")
+			}
+			if write && len(paths) == 0 {
+				log.Fatalf("Cannot write result to STDIN. Paths are expected with write flag.")
 			}
+
 			fset := token.NewFileSet()
-			f, err := parser.ParseFile(fset, "", string(data), parser.ParseComments)
+			var files []*sourceFile
+			var err error
+			if typed {
+				files, err = readTypedSourceFiles(fset, paths)
+			} else {
+				files, err = readSourceFiles(fset, paths)
+			}
 			if err != nil {
-				log.Fatalf("Cannot parse source. %v", err)
-			}
-			node := gaq.MustParseNode(f)
-
-			q := query.MustParse(args[0])
-			nodes := node.QuerySelectorAll(q)
-			switch mode {
-			case "filter":
-				switch format {
-				case "text":
-					printText(data, fset, nodes)
-				case "pos":
-					printPos(nodes)
-				default:
-					log.Fatalf("Format: %s is not supported.", format)
+				log.Fatalf("Cannot read source. %v", err)
+			}
+			if mode == "replace" && !write && !diff && len(files) > 1 {
+				log.Fatalf("Cannot print replaced source of %d files. Write or diff flag is expected for multiple files.", len(files))
+			}
+			fileMatches := [][]*gaq.Match{}
+			for _, f := range files {
+				fileMatches = append(fileMatches, f.root().QueryMatches(q))
+			}
+			var batchReplaced map[*gaq.Match][]byte
+			if batch != "" {
+				batchReplaced, err = replaceByBatch(files, fset, fileMatches, commands, batch)
+				if err != nil {
+					log.Fatalf("Cannot replace by batch. %v", err)
 				}
-			case "replace":
-				if len(args) < 2 {
-					log.Fatalf("One or more command and args are expected in replace mode.")
+			}
+			withName := len(files) > 1
+			jsonMatches := []*match{}
+			changed := false
+			for i, f := range files {
+				matches := fileMatches[i]
+				switch mode {
+				case "filter":
+					switch format {
+					case "text":
+						printText(f, fset, matches, withName)
+					case "pos":
+						printPos(f, fset, matches)
+					case "json":
+						jsonMatches = append(jsonMatches, buildMatches(f, fset, matches)...)
+					case "jsonl":
+						printJSONL(buildMatches(f, fset, matches))
+					default:
+						log.Fatalf("Format: %s is not supported.", format)
+					}
+				case "replace":
+					newReplace := func(f *sourceFile) replaceFunc {
+						if tmpl != nil {
+							return replaceByTemplate(f, fset, tmpl)
+						}
+						if batchReplaced != nil {
+							return func(m *gaq.Match, nodeText []byte) []byte {
+								return batchReplaced[m]
+							}
+						}
+						return replaceByCommand(commands)
+					}
+					if (write || diff) && len(matches) == 0 {
+						continue
+					}
+					replaced, edits, err := replaceFile(f, fset, q, matches, overlap, newReplace)
+					if err != nil {
+						log.Fatalf("Cannot replace. %v", err)
+					}
+					if write || gofmt || fixImports {
+						replaced, err = formatSource(f.name, replaced, edits, gofmt, fixImports)
+						if err != nil {
+							log.Fatalf("Cannot replace. %v", err)
+						}
+					}
+					if !write && !diff {
+						fmt.Println(string(replaced))
+						continue
+					}
+					if diff {
+						d, err := unifiedDiff(f.name, f.source, replaced)
+						if err != nil {
+							log.Fatalf("Cannot make diff. %v", err)
+						}
+						if d != "" {
+							fmt.Print(d)
+							changed = true
+						}
+					}
+					if write {
+						if err := writeSourceFile(f, replaced); err != nil {
+							log.Fatalf("Cannot write file. %v", err)
+						}
+					}
+				default:
+					log.Fatalf("Mode: %s is not supported.", mode)
 				}
-				fmt.Println(string(replaceByCommand(data, fset, nodes, args[1:])))
-			default:
-				log.Fatalf("Mode: %s is not supported.", mode)
+			}
+			if mode == "filter" && format == "json" {
+				printJSON(jsonMatches)
+			}
+			if changed {
+				os.Exit(1)
 			}
 		},
 	}
-	rootCmd.PersistentFlags().StringVarP(&format, "format", "f", "text", "Output format, 'text' or 'pos'. Default is 'text'")
+	rootCmd.PersistentFlags().StringVarP(&format, "format", "f", "text", "Output format, 'text', 'pos', 'json' or 'jsonl'. Default is 'text'")
 	rootCmd.PersistentFlags().StringVarP(&mode, "mode", "m", "filter", "Execution mode, 'filter' or 'replace'. Default is 'filter'")
+	rootCmd.PersistentFlags().BoolVarP(&write, "write", "w", false, "Write result to source file instead of STDOUT in replace mode")
+	rootCmd.PersistentFlags().BoolVarP(&diff, "diff", "d", false, "Print unified diff instead of result in replace mode. Exit code is 1 if any diff exists")
+	rootCmd.PersistentFlags().BoolVarP(&typed, "types", "t", false, "Load paths as package patterns with type information. Needed for :type, :implements, :object and :assignable-to")
+	rootCmd.PersistentFlags().BoolVarP(&pattern, "pattern", "p", false, "Parse query as go code pattern with metavariables like '$x' and '$*x'")
+	rootCmd.PersistentFlags().StringVar(&templateText, "template", "", "Replace matched nodes by go text/template instead of command in replace mode")
+	rootCmd.PersistentFlags().StringVar(&batch, "batch", "", "Spawn command once for all matched nodes in replace mode. Records are framed by 'nul' or 'jsonl'")
+	rootCmd.PersistentFlags().Lookup("batch").NoOptDefVal = batchNUL
+	rootCmd.PersistentFlags().StringVar(&overlap, "overlap", overlapOutermost, "Policy for matches nested in other matches in replace mode, 'outermost', 'innermost' or 'error'")
+	rootCmd.PersistentFlags().BoolVar(&gofmt, "fmt", false, "Format rewritten file by gofmt in replace mode")
+	rootCmd.PersistentFlags().BoolVar(&fixImports, "imports", false, "Fix imports of rewritten file and format it like goimports in replace mode")
 	rootCmd.SetVersionTemplate(`{{printf "%s" .Version}}`)
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
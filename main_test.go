@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestBuildMatches(t *testing.T) {
+	source := "package a\n\nfunc f() {\n\tg(x)\n}\n"
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"CallExpr",
+			`[{"type":"ast.CallExpr","file":"a.go",` +
+				`"start":{"line":4,"column":2,"offset":23},"end":{"line":4,"column":6,"offset":27},` +
+				`"text":"g(x)","path":["ast.File","ast.FuncDecl","ast.BlockStmt","ast.ExprStmt"]}]`,
+		},
+		{
+			"CallExpr > Ident@Args[Name=$arg]",
+			`[{"type":"ast.Ident","file":"a.go",` +
+				`"start":{"line":4,"column":4,"offset":25},"end":{"line":4,"column":5,"offset":26},` +
+				`"text":"x","path":["ast.File","ast.FuncDecl","ast.BlockStmt","ast.ExprStmt","ast.CallExpr"],` +
+				`"captures":{"arg":"x"}}]`,
+		},
+		{
+			"File",
+			`[{"type":"ast.File","file":"a.go",` +
+				`"start":{"line":1,"column":1,"offset":0},"end":{"line":5,"column":2,"offset":29},` +
+				`"text":"package a\n\nfunc f() {\n\tg(x)\n}","path":[]}]`,
+		},
+		{
+			"GenDecl",
+			`[]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			fset := token.NewFileSet()
+			f, err := parseSourceFile(fset, "a.go", []byte(source))
+			if !assert.NoError(t, err) {
+				return
+			}
+			data, err := json.Marshal(buildMatches(f, fset, f.root().QueryMatches(query.MustParse(tt.query))))
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"log"
+	"sort"
+
+	"github.com/tamayika/gaq/pkg/gaq"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+const (
+	overlapOutermost = "outermost"
+	overlapInnermost = "innermost"
+	overlapError     = "error"
+)
+
+// replaceFile replaces matched nodes in file. Matches nested in other matches are handled by policy.
+//
+// outermost: nested matches are skipped.
+// innermost: nested matches are replaced first, then the file is parsed and queried again to replace outer matches.
+// error: nested matches are reported as error.
+func replaceFile(f *sourceFile, fset *token.FileSet, q *query.Query, matches []*gaq.Match, policy string, newReplace func(f *sourceFile) replaceFunc) ([]byte, []*edit, error) {
+	sortMatches(matches)
+	depths := matchDepths(matches)
+	nested := []*gaq.Match{}
+	outermost := []*gaq.Match{}
+	for _, m := range matches {
+		if depths[m] > 0 {
+			nested = append(nested, m)
+		} else {
+			outermost = append(outermost, m)
+		}
+	}
+	if len(nested) > 0 && policy != overlapError {
+		log.Printf("%s: %d nested matches are handled by %s overlap policy", f.name, len(nested), policy)
+	}
+	switch policy {
+	case overlapOutermost:
+		source, edits := replaceNodes(f.source, fset, outermost, newReplace(f))
+		return source, edits, nil
+	case overlapInnermost:
+		return replaceInnermostFirst(f, fset, q, matches, depths, newReplace)
+	case overlapError:
+		if len(nested) > 0 {
+			n := nested[0].Node.Node
+			return nil, nil, fmt.Errorf("%s: match is nested in other match", formatPos(f.name, fset.Position(n.Pos()), fset.Position(n.End())))
+		}
+		source, edits := replaceNodes(f.source, fset, matches, newReplace(f))
+		return source, edits, nil
+	}
+	return nil, nil, fmt.Errorf("overlap policy %s is not supported", policy)
+}
+
+// sortMatches sorts matches by position. Outer node comes first if positions are the same.
+func sortMatches(matches []*gaq.Match) {
+	depth := func(n *gaq.Node) int {
+		d := 0
+		for p := n.Parent; p != nil; p = p.Parent {
+			d++
+		}
+		return d
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		ni, nj := matches[i].Node, matches[j].Node
+		if ni.Pos != nj.Pos {
+			return ni.Pos < nj.Pos
+		}
+		if ni.End != nj.End {
+			return ni.End > nj.End
+		}
+		return depth(ni) < depth(nj)
+	})
+}
+
+// matchDepths returns the number of matched ancestors of each match
+func matchDepths(matches []*gaq.Match) map[*gaq.Match]int {
+	matched := map[*gaq.Node]bool{}
+	for _, m := range matches {
+		matched[m.Node] = true
+	}
+	depths := map[*gaq.Match]int{}
+	for _, m := range matches {
+		for p := m.Node.Parent; p != nil; p = p.Parent {
+			if matched[p] {
+				depths[m]++
+			}
+		}
+	}
+	return depths
+}
+
+// replaceTarget represents the range of match which is not replaced yet
+type replaceTarget struct {
+	start    int
+	end      int
+	nodeType string
+	depth    int
+}
+
+// replaceInnermostFirst replaces the deepest matches first.
+// Ranges of outer matches are moved by replaced texts, and they are found again in the re-parsed file.
+// Outer matches which are no longer matched after re-parse are skipped.
+func replaceInnermostFirst(f *sourceFile, fset *token.FileSet, q *query.Query, matches []*gaq.Match, depths map[*gaq.Match]int, newReplace func(f *sourceFile) replaceFunc) ([]byte, []*edit, error) {
+	targets := []*replaceTarget{}
+	maxDepth := 0
+	for _, m := range matches {
+		targets = append(targets, &replaceTarget{
+			start:    fset.Position(m.Node.Node.Pos()).Offset,
+			end:      fset.Position(m.Node.Node.End()).Offset,
+			nodeType: m.Node.Type,
+			depth:    depths[m],
+		})
+		if depths[m] > maxDepth {
+			maxDepth = depths[m]
+		}
+	}
+
+	current := f
+	currentMatches := matches
+	var edits []*edit
+	for depth := maxDepth; depth >= 0; depth-- {
+		if depth != maxDepth {
+			parsed, err := parseSourceFile(fset, f.name, current.source)
+			if err != nil {
+				return nil, nil, rewriteError(current.source, edits, err)
+			}
+			current = parsed
+			currentMatches = parsed.root().QueryMatches(q)
+			sortMatches(currentMatches)
+		}
+		type key struct {
+			start    int
+			end      int
+			nodeType string
+		}
+		index := map[key]*gaq.Match{}
+		for _, m := range currentMatches {
+			k := key{fset.Position(m.Node.Node.Pos()).Offset, fset.Position(m.Node.Node.End()).Offset, m.Node.Type}
+			if _, ok := index[k]; !ok {
+				index[k] = m
+			}
+		}
+		roundMatches := []*gaq.Match{}
+		roundTargets := []*replaceTarget{}
+		for _, t := range targets {
+			if t.depth != depth {
+				continue
+			}
+			if m, ok := index[key{t.start, t.end, t.nodeType}]; ok {
+				roundMatches = append(roundMatches, m)
+				roundTargets = append(roundTargets, t)
+			}
+		}
+		var source []byte
+		source, edits = replaceNodes(current.source, fset, roundMatches, newReplace(current))
+		// moves outer ranges from the last replacement so that earlier offsets are kept valid
+		for i := len(roundTargets) - 1; i >= 0; i-- {
+			r := roundTargets[i]
+			delta := (edits[i].end - edits[i].start) - len(edits[i].original)
+			for _, t := range targets {
+				if t.depth >= depth {
+					continue
+				}
+				if t.start <= r.start && r.end <= t.end {
+					t.end += delta
+				} else if t.start >= r.end {
+					t.start += delta
+					t.end += delta
+				}
+			}
+		}
+		current = &sourceFile{name: f.name, source: source}
+	}
+	return current.source, edits, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestReplaceFile(t *testing.T) {
+	wrap := func(m *gaq.Match, text []byte) []byte {
+		return []byte("w(" + string(text) + ")")
+	}
+	rename := func(m *gaq.Match, text []byte) []byte {
+		return []byte("long_" + string(text))
+	}
+	// unwrap replaces call by its first argument
+	unwrap := func(m *gaq.Match, text []byte) []byte {
+		s := string(text)
+		args := s[strings.Index(s, "(")+1 : len(s)-1]
+		return []byte(strings.SplitN(args, ", ", 2)[0])
+	}
+	tests := []struct {
+		name    string
+		source  string
+		policy  string
+		replace replaceFunc
+		want    string
+		wantErr bool
+	}{
+		{"Outermost", "package a\n\nvar v = f(g(h(x)))\n", overlapOutermost, wrap, "package a\n\nvar v = w(f(g(h(x))))\n", false},
+		{"Innermost", "package a\n\nvar v = f(g(h(x)))\n", overlapInnermost, wrap, "package a\n\nvar v = w(f(w(g(w(h(x))))))\n", false},
+		{"Error", "package a\n\nvar v = f(g(h(x)))\n", overlapError, wrap, "", true},
+		{"Error without nested matches", "package a\n\nvar v = f(x)\nvar w = g(y)\n", overlapError, wrap, "package a\n\nvar v = w(f(x))\nvar w = w(g(y))\n", false},
+		{"Innermost with longer replacement", "package a\n\nvar v = f(g(h(x)))\n", overlapInnermost, rename, "package a\n\nvar v = long_f(long_g(long_h(x)))\n", false},
+		{
+			"Innermost with shorter replacement moves later matches",
+			"package a\n\nvar v = f(g(x), h(y))\nvar w = k(l(z))\n",
+			overlapInnermost,
+			unwrap,
+			"package a\n\nvar v = x\nvar w = z\n",
+			false,
+		},
+		{
+			"Outermost with shorter replacement",
+			"package a\n\nvar v = f(g(x), h(y))\nvar w = k(l(z))\n",
+			overlapOutermost,
+			unwrap,
+			"package a\n\nvar v = g(x)\nvar w = l(z)\n",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			f, err := parseSourceFile(fset, "a.go", []byte(tt.source))
+			if !assert.NoError(t, err) {
+				return
+			}
+			q := query.MustParse("CallExpr")
+			got, _, err := replaceFile(f, fset, q, f.root().QueryMatches(q), tt.policy, func(f *sourceFile) replaceFunc {
+				return tt.replace
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestSortMatches(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parseSourceFile(fset, "a.go", []byte("package a\n\nvar v = f(g(h(x)), k(y))\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	matches := f.root().QueryMatches(query.MustParse("CallExpr > Ident@Fun, CallExpr"))
+	// reverse so that sorting is tested
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	sortMatches(matches)
+	texts := []string{}
+	for _, m := range matches {
+		texts = append(texts, string(f.source[fset.Position(m.Node.Node.Pos()).Offset:fset.Position(m.Node.Node.End()).Offset]))
+	}
+	// outer node comes first at the same position
+	assert.Equal(t, []string{"f(g(h(x)), k(y))", "f", "g(h(x))", "g", "h(x)", "h", "k(y)", "k"}, texts)
+
+	depths := matchDepths(matches)
+	got := []int{}
+	for _, m := range matches {
+		got = append(got, depths[m])
+	}
+	assert.Equal(t, []int{0, 1, 1, 2, 2, 3, 1, 2}, got)
+}
@@ -6,9 +6,13 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"log"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/tamayika/gaq/pkg/gaq/query"
 )
@@ -20,10 +24,18 @@ type Node struct {
 	End      int     `json:"end"`
 	Children []*Node `json:"children,omitempty"`
 
-	Parent *Node    `json:"-"`
-	Index  int      `json:"-"`
-	Node   ast.Node `json:"-"`
-	Name   string   `json:"-"`
+	Parent     *Node    `json:"-"`
+	Index      int      `json:"-"`
+	Node       ast.Node `json:"-"`
+	Name       string   `json:"-"`
+	Field      string   `json:"-"`
+	FieldIndex int      `json:"-"`
+
+	Types     *types.Package `json:"-"`
+	TypesInfo *types.Info    `json:"-"`
+
+	indexOnce sync.Once
+	index     *nodeIndex
 }
 
 // Parse parses source and returns *Node
@@ -67,8 +79,12 @@ func MustParseNode(n ast.Node) *Node {
 }
 
 type walker struct {
-	node *Node
-	err  error
+	node      *Node
+	err       error
+	types     *types.Package
+	typesInfo *types.Info
+	// fields holds field of node's children, built at the first child
+	fields map[ast.Node]childField
 }
 
 func (w *walker) Visit(node ast.Node) ast.Visitor {
@@ -76,9 +92,17 @@ func (w *walker) Visit(node ast.Node) ast.Visitor {
 		return nil
 	}
 	child := buildNode(node)
+	child.Types = w.types
+	child.TypesInfo = w.typesInfo
 	child.Parent = w.node
 	if child.Parent != nil {
+		if w.fields == nil {
+			w.fields = childFields(child.Parent.Node)
+		}
 		child.Index = len(child.Parent.Children)
+		if f, ok := w.fields[node]; ok {
+			child.Field, child.FieldIndex = f.name, f.index
+		}
 	}
 	if w.node == nil {
 		// for file
@@ -86,24 +110,65 @@ func (w *walker) Visit(node ast.Node) ast.Visitor {
 	} else {
 		w.node.Children = append(w.node.Children, child)
 	}
-	return &walker{node: child}
+	return &walker{node: child, types: w.types, typesInfo: w.typesInfo}
 }
 
 func buildNode(n ast.Node) *Node {
 	nodeType := nodeType(n)
 	splits := strings.Split(nodeType, ".")
 	node := &Node{
-		Type:     nodeType,
-		Pos:      int(n.Pos()),
-		End:      int(n.End()),
-		Children: []*Node{},
-		Node:     n,
-		Name:     splits[len(splits)-1],
-		Index:    -1,
+		Type:       nodeType,
+		Pos:        int(n.Pos()),
+		End:        int(n.End()),
+		Children:   []*Node{},
+		Node:       n,
+		Name:       splits[len(splits)-1],
+		Index:      -1,
+		FieldIndex: -1,
 	}
 	return node
 }
 
+// childField represents the field of parent which holds child.
+// If the field is slice, index is the index in the slice, otherwise index is -1.
+type childField struct {
+	name  string
+	index int
+}
+
+// childFields returns the fields of parent by child node.
+// If the same node is held by several fields, the first field is returned.
+func childFields(parent ast.Node) map[ast.Node]childField {
+	fields := map[ast.Node]childField{}
+	add := func(value reflect.Value, f childField) {
+		child, ok := value.Interface().(ast.Node)
+		if !ok || value.IsNil() {
+			return
+		}
+		if _, ok := fields[child]; !ok {
+			fields[child] = f
+		}
+	}
+	v := reflect.ValueOf(parent).Elem()
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			add(field, childField{t.Field(i).Name, -1})
+		case reflect.Slice:
+			kind := field.Type().Elem().Kind()
+			if kind != reflect.Ptr && kind != reflect.Interface {
+				continue
+			}
+			for j := 0; j < field.Len(); j++ {
+				add(field.Index(j), childField{t.Field(i).Name, j})
+			}
+		}
+	}
+	return fields
+}
+
 func nodeType(n interface{}) string {
 	var bf bytes.Buffer
 	fmt.Fprintf(&bf, "%T", n)
@@ -148,97 +213,172 @@ func (n *Node) NextSibilings() []*Node {
 	return n.Parent.Children[nextIndex:]
 }
 
-// QuerySelector queries to node and return first matched node
+// PrevSibling returns previous sibling if exists
+func (n *Node) PrevSibling() *Node {
+	if n.Parent == nil || n.Index <= 0 {
+		return nil
+	}
+	return n.Parent.Children[n.Index-1]
+}
+
+// Ancestors returns ancestors from parent to the root
+func (n *Node) Ancestors() []*Node {
+	ancestors := []*Node{}
+	for parent := n.Parent; parent != nil; parent = parent.Parent {
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// Path returns query which selects only node from the root, e.g. `File:root > FuncDecl:nth-child(2) > Ident:nth-child(1)`
+func (n *Node) Path() string {
+	if n.Parent == nil {
+		return n.Name + ":root"
+	}
+	return fmt.Sprintf("%s > %s:nth-child(%d)", n.Parent.Path(), n.Name, n.Index+1)
+}
+
+// QuerySelector queries to node and return the first matched node in document order
 func (n *Node) QuerySelector(q *query.Query) ast.Node {
-	var firstNode ast.Node
-	for _, selector := range q.Selectors {
-		n.apply(selector, 0, 0, -1, func(n *Node) bool {
-			firstNode = n.Node
-			return false
-		})
-		if firstNode != nil {
-			break
-		}
+	node := n.Select(q)
+	if node == nil {
+		return nil
 	}
-	return firstNode
+	return node.Node
 }
 
-// QuerySelectorAll queries to node and return all matched nodes
+// QuerySelectorAll queries to node and return all matched nodes in document order
 func (n *Node) QuerySelectorAll(q *query.Query) []ast.Node {
 	nodes := []ast.Node{}
-	addedNodes := map[*Node]bool{}
-	for _, selector := range q.Selectors {
-		n.apply(selector, 0, 0, -1, func(n *Node) bool {
-			if _, ok := addedNodes[n]; !ok {
-				nodes = append(nodes, n.Node)
-				addedNodes[n] = true
-			}
-			return true
-		})
+	for _, node := range n.SelectAll(q) {
+		nodes = append(nodes, node.Node)
 	}
 	return nodes
 }
 
+// Select queries to node and return the first matched *Node in document order.
+// It is the first node of SelectAll.
+func (n *Node) Select(q *query.Query) *Node {
+	matches := n.QueryMatches(q)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0].Node
+}
+
+// SelectAll queries to node and return all matched *Node in document order.
+// Nodes matched by several selectors are returned once.
+func (n *Node) SelectAll(q *query.Query) []*Node {
+	nodes := []*Node{}
+	for _, m := range n.QueryMatches(q) {
+		nodes = append(nodes, m.Node)
+	}
+	return nodes
+}
+
+// SelectAllBySelector queries to node and return matched *Node grouped by selector in query.
+// Each group is in document order, and the same node can be in several groups.
+func (n *Node) SelectAllBySelector(q *query.Query) [][]*Node {
+	groups := [][]*Node{}
+	for _, matches := range n.QueryMatchesBySelector(q) {
+		nodes := []*Node{}
+		for _, m := range matches {
+			nodes = append(nodes, m.Node)
+		}
+		groups = append(groups, nodes)
+	}
+	return groups
+}
+
+// Matches checks whether node matches query.
+// Combinators are matched against ancestors and previous siblings up to the root, not only in the descendants of receiver.
+// `:scope` represents node itself.
+func (n *Node) Matches(q *query.Query) bool {
+	return n.isMatchAnySelector(newMatchContext(n), q.Selectors)
+}
+
+// Closest returns node itself or the nearest ancestor which matches query.
+// `:scope` represents node itself, not the ancestor being checked.
+func (n *Node) Closest(q *query.Query) *Node {
+	for node := n; node != nil; node = node.Parent {
+		if node.isMatchAnySelector(newMatchContext(n), q.Selectors) {
+			return node
+		}
+	}
+	return nil
+}
+
 type callback func(n *Node) bool
 
-func (n *Node) apply(s *query.Selector, selectorIndex int, nodeDepth int, lastMatchedNodeDepth int, cb callback) bool {
+// apply walks node and its descendants and calls cb for nodes matched with selector.
+// Descendants are always visited because they can match with other metavariable bindings.
+// Without metavariables, node already visited at the same selector index is skipped.
+func (n *Node) apply(c *matchContext, s *query.Selector, selectorIndex int, nodeDepth int, lastMatchedNodeDepth int, cb callback) bool {
 	ss := s.SimpleSelectors[selectorIndex]
 	mustBeChild := ss.Combinator == ">"
 	mustBeDecendant := mustBeChild || ss.Combinator == ""
 	if mustBeChild && lastMatchedNodeDepth >= 0 && nodeDepth-lastMatchedNodeDepth > 1 {
 		return true
 	}
-	if n.isMatchSimpleSelector(ss) {
-		if selectorIndex+1 == len(s.SimpleSelectors) {
-			continues := cb(n)
+	if c.visited != nil {
+		key := visit{s, n, selectorIndex}
+		if c.visited[key] {
+			return true
+		}
+		c.visited[key] = true
+	}
+	mark := c.mark()
+	continues := true
+	if n.isMatchSimpleSelector(c, ss) {
+		continues = n.applyNext(c, s, selectorIndex, nodeDepth, cb)
+	}
+	c.rollback(mark)
+	if !continues {
+		return false
+	}
+	if mustBeDecendant {
+		return n.applyChildren(c, s, selectorIndex, nodeDepth+1, lastMatchedNodeDepth, cb)
+	}
+	return true
+}
+
+// applyNext applies the rest of selector to nodes related with n, which is matched at selectorIndex
+func (n *Node) applyNext(c *matchContext, s *query.Selector, selectorIndex int, nodeDepth int, cb callback) bool {
+	if selectorIndex+1 == len(s.SimpleSelectors) {
+		return cb(n)
+	}
+	nextEntry := s.SimpleSelectors[selectorIndex+1]
+	switch nextEntry.Combinator {
+	case ">", "":
+		return n.applyChildren(c, s, selectorIndex+1, nodeDepth+1, nodeDepth, cb)
+	case "+":
+		nextSibling := n.NextSibiling()
+		if nextSibling == nil {
+			return true
+		}
+		return nextSibling.apply(c, s, selectorIndex+1, nodeDepth, nodeDepth, cb)
+	case "~":
+		for _, nextSibling := range n.NextSibilings() {
+			continues := nextSibling.apply(c, s, selectorIndex+1, nodeDepth, nodeDepth, cb)
 			if !continues {
 				return false
 			}
-			// if selector length is 1, we must continue to query
-			if len(s.SimpleSelectors) > 1 {
-				return continues
-			}
-		} else {
-			nextEntry := s.SimpleSelectors[selectorIndex+1]
-			switch nextEntry.Combinator {
-			case ">", "":
-				return n.applyChildren(s, selectorIndex+1, nodeDepth+1, nodeDepth, cb)
-			case "+":
-				nextSibling := n.NextSibiling()
-				if nextSibling == nil {
-					return true
-				}
-				return nextSibling.apply(s, selectorIndex+1, nodeDepth, nodeDepth, cb)
-			case "~":
-				nextSibilings := n.NextSibilings()
-				if nextSibilings == nil {
-					return true
-				}
-				for _, nextSibling := range nextSibilings {
-					continues := nextSibling.apply(s, selectorIndex+1, nodeDepth, nodeDepth, cb)
-					if !continues {
-						return false
-					}
-				}
-				return true
-			default:
-				return true
-			}
 		}
 	}
-	if mustBeDecendant {
-		return n.applyChildren(s, selectorIndex, nodeDepth+1, lastMatchedNodeDepth, cb)
-	}
 	return true
 }
 
-func (n *Node) isMatchSimpleSelector(ss *query.SimpleSelector) bool {
-	return (ss.Name == n.Name || ss.Name == "*" || ss.Name == "") && n.isMatchOptions(ss.Options)
+func (n *Node) isMatchSimpleSelector(c *matchContext, ss *query.SimpleSelector) bool {
+	return n.isMatchNameAndField(ss) && n.isMatchOptions(c, ss)
+}
+
+func (n *Node) isMatchNameAndField(ss *query.SimpleSelector) bool {
+	return (ss.Name == n.Name || ss.Name == "*" || ss.Name == "") && (ss.Field == "" || ss.Field == n.Field)
 }
 
-func (n *Node) applyChildren(s *query.Selector, selectorIndex int, nodeDepth int, lastMatchedNodeDepth int, cb callback) bool {
+func (n *Node) applyChildren(c *matchContext, s *query.Selector, selectorIndex int, nodeDepth int, lastMatchedNodeDepth int, cb callback) bool {
 	for _, childNode := range n.Children {
-		continues := childNode.apply(s, selectorIndex, nodeDepth, lastMatchedNodeDepth, cb)
+		continues := childNode.apply(c, s, selectorIndex, nodeDepth, lastMatchedNodeDepth, cb)
 		if !continues {
 			return false
 		}
@@ -246,67 +386,181 @@ func (n *Node) applyChildren(s *query.Selector, selectorIndex int, nodeDepth int
 	return true
 }
 
-func (n *Node) isMatchOptions(opts []*query.SimpleSelectorOption) bool {
-	if opts == nil {
-		return true
-	}
-	for _, opt := range opts {
-		if !n.isMatchOption(opt) {
+func (n *Node) isMatchOptions(c *matchContext, ss *query.SimpleSelector) bool {
+	for _, opt := range ss.Options {
+		if !n.isMatchOption(c, opt, ss.Field) {
 			return false
 		}
 	}
 	return true
 }
 
-func (n *Node) isMatchOption(opt *query.SimpleSelectorOption) bool {
-	return n.isMatchOptionAttribute(opt.Attribute) && n.isMatchOptionPseudo(opt.Pseudo)
+// isMatchOption checks option of simple selector. Positional pseudo classes count siblings held by field if field is not empty.
+func (n *Node) isMatchOption(c *matchContext, opt *query.SimpleSelectorOption, field string) bool {
+	return n.isMatchOptionAttribute(c, opt.Attribute) && n.isMatchOptionPseudo(c, opt.Pseudo, field) && n.isMatchOptionPattern(c, opt.Pattern)
 }
 
-func (n *Node) isMatchOptionAttribute(oa *query.Attribute) bool {
+func (n *Node) isMatchOptionAttribute(c *matchContext, oa *query.Attribute) bool {
 	if oa == nil {
 		return true
 	}
-	nodeValue := reflect.ValueOf(n.Node).Elem()
-	field := nodeValue.FieldByName(oa.Name)
-	if !field.IsValid() {
+	path := oa.Path
+	if path == nil {
+		path = strings.Split(oa.Name, ".")
+	}
+	field, ok := fieldByPath(reflect.ValueOf(n.Node), path)
+	if !ok {
 		return false
 	}
-	v := field.Interface()
-	value, ok := v.(string)
+	if oa.Operator == "" {
+		return !isNilValue(field)
+	}
+	value, ok := attributeValue(field)
 	if !ok {
 		return false
 	}
+	if oa.Variable != "" {
+		return c.bind(oa.Variable, value, n, oa.Modifier == "i")
+	}
+	expected := oa.Value
+	if oa.Modifier == "i" {
+		value = foldCase(value)
+		expected = foldCase(expected)
+	}
 	switch oa.Operator {
 	case "=":
-		return oa.Value == value
+		return isEqualAttributeValue(field, value, expected)
 	case "~=":
 		splitted := strings.Split(value, " ")
 		found := false
 		for _, s := range splitted {
-			if s == oa.Value {
+			if s == expected {
 				found = true
 				break
 			}
 		}
 		return found
 	case "|=":
-		return strings.Contains(value, fmt.Sprintf("%s-", oa.Value))
+		return strings.Contains(value, fmt.Sprintf("%s-", expected))
 	case "^=":
-		return strings.HasPrefix(value, oa.Value)
+		return strings.HasPrefix(value, expected)
 	case "$=":
-		return strings.HasSuffix(value, oa.Value)
+		return strings.HasSuffix(value, expected)
 	case "*=":
-		return strings.Contains(value, oa.Value)
+		return strings.Contains(value, expected)
+	case "=~":
+		return oa.Regexp.MatchString(value)
+	case "!~":
+		return !oa.Regexp.MatchString(value)
+	}
+	return false
+}
+
+// foldCase maps each rune to the smallest rune of its Unicode simple case folding orbit
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		folded := r
+		for c := unicode.SimpleFold(r); c != r; c = unicode.SimpleFold(c) {
+			if c < folded {
+				folded = c
+			}
+		}
+		return folded
+	}, s)
+}
+
+// fieldByPath walks struct fields, slice indexes and pointers by dotted path segments
+func fieldByPath(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, name := range path {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			v = v.FieldByName(name)
+			if !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		case reflect.Slice, reflect.Array:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= v.Len() {
+				return reflect.Value{}, false
+			}
+			v = v.Index(i)
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	return v, true
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return v.IsNil()
 	}
 	return false
 }
 
-func (n *Node) isMatchOptionPseudo(op *query.Pseudo) bool {
+// attributeValue converts field value to string for comparison.
+// token.Token and other fmt.Stringer are converted by String(), *ast.Ident is converted to its Name.
+func attributeValue(field reflect.Value) (string, bool) {
+	if field.Kind() == reflect.Interface || field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return "", false
+		}
+	}
+	v := field.Interface()
+	if ident, ok := v.(*ast.Ident); ok {
+		return ident.Name, true
+	}
+	if stringer, ok := v.(fmt.Stringer); ok {
+		return stringer.String(), true
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), true
+	}
+	return "", false
+}
+
+// isEqualAttributeValue compares value with expected.
+// For bool and numeric field without String(), expected is parsed as the literal of its kind.
+func isEqualAttributeValue(field reflect.Value, value string, expected string) bool {
+	if _, ok := field.Interface().(fmt.Stringer); ok {
+		return value == expected
+	}
+	switch field.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(expected)
+		return err == nil && b == field.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(expected, 0, 64)
+		return err == nil && i == field.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(expected, 0, 64)
+		return err == nil && u == field.Uint()
+	}
+	return value == expected
+}
+
+func (n *Node) isMatchOptionPseudo(c *matchContext, op *query.Pseudo, field string) bool {
 	if op == nil {
 		return true
 	}
 
-	if op.Empty != nil {
+	if op.AssignableTo != nil {
+		return n.isMatchAssignableTo(op.AssignableTo.Type)
+	} else if op.Empty != nil {
 		if len(n.Children) == 0 {
 			return true
 		}
@@ -321,54 +575,183 @@ func (n *Node) isMatchOptionPseudo(op *query.Pseudo) bool {
 		}
 		return true
 	} else if op.FirstChild != nil {
-		return n.Index == 0
+		i, _ := n.position(field, false)
+		return i == 0
 	} else if op.FirstOfType != nil {
-		if n.Parent != nil {
-			for i, child := range n.Parent.SameTypeChildren(n) {
-				if child == n {
-					return i == 0
-				}
-			}
-		}
+		i, _ := n.position(field, true)
+		return i == 0
 	} else if op.Has != nil {
+		// metavariables bound by the first found descendant are kept
+		mark := c.mark()
+		visited := c.visited
+		defer func() { c.visited = visited }()
 		for _, selector := range op.Has.Selectors {
-			found := false
-			n.apply(selector, 0, 1, 0, func(n *Node) bool {
-				found = true
-				return true
+			var bound []*Capture
+			c.visited = newVisited(selector)
+			n.applyChildren(c, selector, 0, 1, 0, func(n *Node) bool {
+				bound = c.since(mark)
+				return false
 			})
-			if found {
+			if bound != nil {
+				c.restore(bound)
 				return true
 			}
 		}
+	} else if op.Implements != nil {
+		return n.isMatchImplements(op.Implements.Type)
 	} else if op.Is != nil {
-		for _, selector := range op.Is.Selectors {
-			if n.isMatchSimpleSelector(selector.SimpleSelectors[0]) {
+		return n.isMatchAnySelector(c, op.Is.Selectors)
+	} else if op.LastChild != nil {
+		i, count := n.position(field, false)
+		return i >= 0 && i == count-1
+	} else if op.LastOfType != nil {
+		i, count := n.position(field, true)
+		return i >= 0 && i == count-1
+	} else if op.Not != nil {
+		return !n.isMatchAnySelector(c, op.Not.Selectors)
+	} else if op.NthChild != nil {
+		return n.isMatchNth(c, op.NthChild.Nth, op.NthChild.Selectors, field, false, false)
+	} else if op.NthLastChild != nil {
+		return n.isMatchNth(c, op.NthLastChild.Nth, op.NthLastChild.Selectors, field, false, true)
+	} else if op.NthLastOfType != nil {
+		return n.isMatchNth(c, op.NthLastOfType.Nth, nil, field, true, true)
+	} else if op.NthOfType != nil {
+		return n.isMatchNth(c, op.NthOfType.Nth, nil, field, true, false)
+	} else if op.Object != nil {
+		return n.isMatchObject(op.Object.Object)
+	} else if op.OnlyChild != nil {
+		_, count := n.position(field, false)
+		return count == 1
+	} else if op.OnlyOfType != nil {
+		_, count := n.position(field, true)
+		return count == 1
+	} else if op.Root != nil {
+		return n.Parent == nil
+	} else if op.Scope != nil {
+		return n == c.scope
+	} else if op.Type != nil {
+		return n.isMatchType(op.Type.Type)
+	} else if op.Where != nil {
+		return n.isMatchAnySelector(c, op.Where.Selectors)
+	}
+	return false
+}
+
+// isMatchNth checks whether 1-based position among siblings matches nth.
+// If selectors are given, only siblings matching them are counted.
+func (n *Node) isMatchNth(c *matchContext, nth *query.Nth, selectors []*query.Selector, field string, ofType bool, fromLast bool) bool {
+	if n.Parent == nil {
+		return false
+	}
+	siblings := n.siblings(field, ofType)
+	if len(selectors) > 0 {
+		if !n.isMatchAnySelector(c, selectors) {
+			return false
+		}
+		filtered := []*Node{}
+		for _, sibling := range siblings {
+			mark := c.mark()
+			if sibling.isMatchAnySelector(c, selectors) {
+				filtered = append(filtered, sibling)
+			}
+			c.rollback(mark)
+		}
+		siblings = filtered
+	}
+	for i, sibling := range siblings {
+		if sibling == n {
+			if fromLast {
+				return nth.Match(len(siblings) - i)
+			}
+			return nth.Match(i + 1)
+		}
+	}
+	return false
+}
+
+// siblings returns children of parent which are counted by positional pseudo classes.
+// If field is not empty, only children held by the field of parent are returned, so `CallExpr > *@Args:nth-child(2)` is the second argument.
+// If ofType is true, only children of the same type are returned.
+func (n *Node) siblings(field string, ofType bool) []*Node {
+	if n.Parent == nil {
+		return nil
+	}
+	siblings := []*Node{}
+	for _, child := range n.Parent.Children {
+		if (field == "" || child.Field == field) && (!ofType || child.Type == n.Type) {
+			siblings = append(siblings, child)
+		}
+	}
+	return siblings
+}
+
+// position returns 0-based position of node among siblings and the number of siblings.
+// Position is -1 if node has no parent.
+func (n *Node) position(field string, ofType bool) (int, int) {
+	siblings := n.siblings(field, ofType)
+	if field != "" && !ofType && n.FieldIndex >= 0 {
+		return n.FieldIndex, len(siblings)
+	}
+	for i, sibling := range siblings {
+		if sibling == n {
+			return i, len(siblings)
+		}
+	}
+	return -1, len(siblings)
+}
+
+func (n *Node) isMatchAnySelector(c *matchContext, selectors []*query.Selector) bool {
+	for _, selector := range selectors {
+		if n.isMatchSelector(c, selector, len(selector.SimpleSelectors)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMatchSelector checks whether node matches selector from right to left.
+// Combinators are matched against ancestors and previous siblings.
+// If not matched, metavariables bound while matching are undone.
+func (n *Node) isMatchSelector(c *matchContext, s *query.Selector, selectorIndex int) bool {
+	mark := c.mark()
+	if n.isMatchSelectorFrom(c, s, selectorIndex) {
+		return true
+	}
+	c.rollback(mark)
+	return false
+}
+
+func (n *Node) isMatchSelectorFrom(c *matchContext, s *query.Selector, selectorIndex int) bool {
+	ss := s.SimpleSelectors[selectorIndex]
+	if !n.isMatchSimpleSelector(c, ss) {
+		return false
+	}
+	if selectorIndex == 0 {
+		return true
+	}
+	switch ss.Combinator {
+	case "":
+		for parent := n.Parent; parent != nil; parent = parent.Parent {
+			if parent.isMatchSelector(c, s, selectorIndex-1) {
 				return true
 			}
 		}
-	} else if op.LastChild != nil {
+	case ">":
 		if n.Parent != nil {
-			return n.Index == len(n.Parent.Children)-1
+			return n.Parent.isMatchSelector(c, s, selectorIndex-1)
 		}
-	} else if op.LastOfType != nil {
-		if n.Parent != nil {
-			children := n.Parent.SameTypeChildren(n)
-			for i, child := range children {
-				if child == n {
-					return i == len(children)-1
-				}
-			}
+	case "+":
+		if n.Parent != nil && n.Index > 0 {
+			return n.Parent.Children[n.Index-1].isMatchSelector(c, s, selectorIndex-1)
 		}
-	} else if op.Not != nil {
-		for _, selector := range op.Not.Selectors {
-			if n.isMatchSimpleSelector(selector.SimpleSelectors[0]) {
-				return false
+	case "~":
+		if n.Parent != nil && n.Index > 0 {
+			for _, sibling := range n.Parent.Children[:n.Index] {
+				if sibling.isMatchSelector(c, s, selectorIndex-1) {
+					return true
+				}
 			}
 		}
-		return true
-	} else if op.Root != nil {
-		return n.Parent == nil
 	}
 	return false
 }
@@ -1,8 +1,11 @@
 package gaq
 
 import (
+	"fmt"
 	"go/ast"
+	"go/token"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -358,6 +361,232 @@ func TestNode_QuerySelectorAll(t *testing.T) {
 				},
 			},
 		},
+		{
+			"ValueSpec > Ident[Name='userid' i]",
+			MustParse(`package main
+			var userID string
+			var UserId string
+			var userid string
+			var user string
+			`),
+			args{
+				query.MustParse("ValueSpec > Ident[Name='userid' i]"),
+			},
+			[]ast.Node{
+				&ast.Ident{
+					Name: "userID",
+				},
+				&ast.Ident{
+					Name: "UserId",
+				},
+				&ast.Ident{
+					Name: "userid",
+				},
+			},
+		},
+		{
+			"Not matched ValueSpec > Ident[Name^='USER' s]",
+			MustParse(`package main
+			var userID string
+			`),
+			args{
+				query.MustParse("ValueSpec > Ident[Name^='USER' s]"),
+			},
+			[]ast.Node{},
+		},
+		{
+			"File Ident[Name=~/^get[A-Z]/]",
+			MustParse(`package main
+			var getA string
+			var getter string
+			var get string
+			`),
+			args{
+				query.MustParse("File Ident[Name=~/^get[A-Z]/]"),
+			},
+			[]ast.Node{
+				&ast.Ident{
+					Name: "getA",
+				},
+			},
+		},
+		{
+			"BasicLit[Value=~/select .* from/i]",
+			MustParse(`package main
+			var a = "SELECT * FROM users"
+			var b = "users"
+			`),
+			args{
+				query.MustParse("BasicLit[Value=~/select .* from/i]"),
+			},
+			[]ast.Node{
+				&ast.BasicLit{
+					Kind:  token.STRING,
+					Value: `"SELECT * FROM users"`,
+				},
+			},
+		},
+		{
+			"ValueSpec > Ident:first-child[Name!~/^get/]",
+			MustParse(`package main
+			var getA string
+			var setA string
+			`),
+			args{
+				query.MustParse("ValueSpec > Ident:first-child[Name!~/^get/]"),
+			},
+			[]ast.Node{
+				&ast.Ident{
+					Name: "setA",
+				},
+			},
+		},
+		{
+			"BinaryExpr[Op='==']",
+			MustParse(`package main
+			var a = 1 == 2
+			var b = 1 != 2
+			`),
+			args{
+				query.MustParse("BinaryExpr[Op='==']"),
+			},
+			[]ast.Node{
+				&ast.BinaryExpr{
+					Op: token.EQL,
+				},
+			},
+		},
+		{
+			"BasicLit[Kind='STRING']",
+			MustParse(`package main
+			var a = 1
+			var b = "b"
+			`),
+			args{
+				query.MustParse("BasicLit[Kind='STRING']"),
+			},
+			[]ast.Node{
+				&ast.BasicLit{
+					Kind:  token.STRING,
+					Value: `"b"`,
+				},
+			},
+		},
+		{
+			"AssignStmt[Tok=':=']",
+			MustParse(`package main
+			func f() {
+				a := 1
+				a = 2
+			}
+			`),
+			args{
+				query.MustParse("AssignStmt[Tok=':=']"),
+			},
+			[]ast.Node{
+				&ast.AssignStmt{
+					Lhs: []ast.Expr{
+						&ast.Ident{Name: "a"},
+					},
+					Tok: token.DEFINE,
+				},
+			},
+		},
+		{
+			"ChanType[Dir='2']",
+			MustParse(`package main
+			var a chan int
+			var b <-chan int
+			`),
+			args{
+				query.MustParse("ChanType[Dir='2']"),
+			},
+			[]ast.Node{
+				&ast.ChanType{
+					Dir:   ast.RECV,
+					Value: &ast.Ident{Name: "int"},
+				},
+			},
+		},
+		{
+			"StructType[Incomplete='false']",
+			MustParse(`package main
+			type s struct {}
+			`),
+			args{
+				query.MustParse("StructType[Incomplete='false']"),
+			},
+			[]ast.Node{
+				&ast.StructType{},
+			},
+		},
+		{
+			"SelectorExpr[X='fmt']",
+			MustParse(`package main
+			var a = fmt.Sprint
+			var b = os.Args
+			`),
+			args{
+				query.MustParse("SelectorExpr[X='fmt']"),
+			},
+			[]ast.Node{
+				&ast.SelectorExpr{
+					X:   &ast.Ident{Name: "fmt"},
+					Sel: &ast.Ident{Name: "Sprint"},
+				},
+			},
+		},
+		{
+			"CallExpr[Fun.Sel.Name='Println']",
+			MustParse(`package main
+			func f() {
+				fmt.Println()
+				fmt.Print()
+			}
+			`),
+			args{
+				query.MustParse("CallExpr[Fun.Sel.Name='Println']"),
+			},
+			[]ast.Node{
+				&ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X:   &ast.Ident{Name: "fmt"},
+						Sel: &ast.Ident{Name: "Println"},
+					},
+				},
+			},
+		},
+		{
+			"FuncDecl[Recv.List.0.Type.X.Name='Server']",
+			MustParse(`package main
+			func (s *Server) f() {}
+			func (c *Client) f() {}
+			func f() {}
+			`),
+			args{
+				query.MustParse("FuncDecl[Recv.List.0.Type.X.Name='Server']"),
+			},
+			[]ast.Node{
+				&ast.FuncDecl{
+					Name: &ast.Ident{Name: "f"},
+				},
+			},
+		},
+		{
+			"FuncDecl[Type.Results]",
+			MustParse(`package main
+			func f() {}
+			func g() error {}
+			`),
+			args{
+				query.MustParse("FuncDecl[Type.Results]"),
+			},
+			[]ast.Node{
+				&ast.FuncDecl{
+					Name: &ast.Ident{Name: "g"},
+				},
+			},
+		},
 		{
 			"StructType FieldList:empty",
 			MustParse(`package foo
@@ -566,6 +795,372 @@ func TestNode_QuerySelectorAll(t *testing.T) {
 				&ast.StructType{},
 			},
 		},
+		{
+			"Ident:not(FuncDecl > Ident)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+			}
+			`),
+			args{
+				query.MustParse("Ident:not(FuncDecl > Ident)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "foo"},
+				&ast.Ident{Name: "a"},
+			},
+		},
+		{
+			"Ident:is(AssignStmt > Ident, FuncDecl > Ident)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+			}
+			`),
+			args{
+				query.MustParse("Ident:is(AssignStmt > Ident, FuncDecl > Ident)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "f"},
+				&ast.Ident{Name: "a"},
+			},
+		},
+		{
+			"FuncDecl:where(GenDecl ~ FuncDecl)",
+			MustParse(`package foo
+			func f() {
+			}
+			var v = 1
+			func g() {
+			}
+			`),
+			args{
+				query.MustParse("FuncDecl:where(GenDecl ~ FuncDecl)"),
+			},
+			[]ast.Node{
+				&ast.FuncDecl{
+					Name: &ast.Ident{Name: "g"},
+				},
+			},
+		},
+		{
+			"Ident:not(TypeSpec > Ident + StructType Ident)",
+			MustParse(`package foo
+			type s struct {
+				a int
+			}
+			`),
+			args{
+				query.MustParse("Ident:not(TypeSpec > Ident + StructType Ident)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "foo"},
+				&ast.Ident{Name: "s"},
+			},
+		},
+		{
+			"BlockStmt > *:nth-child(odd)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("BlockStmt > *:nth-child(odd)"),
+			},
+			[]ast.Node{
+				&ast.AssignStmt{
+					Lhs: []ast.Expr{
+						&ast.Ident{Name: "a"},
+					},
+				},
+				&ast.AssignStmt{
+					Lhs: []ast.Expr{
+						&ast.Ident{Name: "c"},
+					},
+				},
+			},
+		},
+		{
+			"CallExpr > Ident:nth-child(2n+2)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > Ident:nth-child(2n+2)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "a"},
+				&ast.Ident{Name: "c"},
+			},
+		},
+		{
+			"CallExpr > Ident:nth-last-child(-n+2)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > Ident:nth-last-child(-n+2)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "b"},
+				&ast.Ident{Name: "c"},
+			},
+		},
+		{
+			"BlockStmt > *:nth-child(1 of ExprStmt)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("BlockStmt > *:nth-child(1 of ExprStmt)"),
+			},
+			[]ast.Node{
+				&ast.ExprStmt{},
+			},
+		},
+		{
+			"BlockStmt > *:nth-of-type(3)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("BlockStmt > *:nth-of-type(3)"),
+			},
+			[]ast.Node{
+				&ast.AssignStmt{
+					Lhs: []ast.Expr{
+						&ast.Ident{Name: "c"},
+					},
+				},
+			},
+		},
+		{
+			"BlockStmt > *:nth-last-of-type(1)",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("BlockStmt > *:nth-last-of-type(1)"),
+			},
+			[]ast.Node{
+				&ast.AssignStmt{
+					Lhs: []ast.Expr{
+						&ast.Ident{Name: "c"},
+					},
+				},
+				&ast.ExprStmt{},
+			},
+		},
+		{
+			"ExprStmt > *:only-child",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("ExprStmt > *:only-child"),
+			},
+			[]ast.Node{
+				&ast.CallExpr{
+					Fun: &ast.Ident{Name: "g"},
+				},
+			},
+		},
+		{
+			"BlockStmt > *:only-of-type",
+			MustParse(`package foo
+			func f() {
+				a := 1
+				b := 2
+				c := 3
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("BlockStmt > *:only-of-type"),
+			},
+			[]ast.Node{
+				&ast.ExprStmt{},
+			},
+		},
+		{
+			"CallExpr > @Fun",
+			MustParse(`package foo
+			func f(a int) {
+				g(a, 1, "b")
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > @Fun"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "g"},
+			},
+		},
+		{
+			"FuncDecl > Ident@Name",
+			MustParse(`package foo
+			func f(a int) {
+				g(a, 1, "b")
+			}
+			`),
+			args{
+				query.MustParse("FuncDecl > Ident@Name"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "f"},
+			},
+		},
+		{
+			"CallExpr > *@Args:nth-child(2)",
+			MustParse(`package foo
+			func f() {
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > *@Args:nth-child(2)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "b"},
+			},
+		},
+		{
+			"CallExpr > *:nth-child(2)",
+			MustParse(`package foo
+			func f() {
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > *:nth-child(2)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "a"},
+			},
+		},
+		{
+			"CallExpr > Ident@Args:first-child",
+			MustParse(`package foo
+			func f() {
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > Ident@Args:first-child"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "a"},
+			},
+		},
+		{
+			"CallExpr > Ident@Args:last-child",
+			MustParse(`package foo
+			func f() {
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > Ident@Args:last-child"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "c"},
+			},
+		},
+		{
+			"CallExpr > Ident@Args:nth-last-of-type(1)",
+			MustParse(`package foo
+			func f() {
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > Ident@Args:nth-last-of-type(1)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "c"},
+			},
+		},
+		{
+			"CallExpr > Ident@Fun:only-child",
+			MustParse(`package foo
+			func f() {
+				g(a, b, c)
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > Ident@Fun:only-child"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "g"},
+			},
+		},
+		{
+			"CallExpr > *@Args:nth-child(2 of @Args)",
+			MustParse(`package foo
+			func f(a int) {
+				g(a, 1, "b")
+			}
+			`),
+			args{
+				query.MustParse("CallExpr > *@Args:nth-child(2 of @Args)"),
+			},
+			[]ast.Node{
+				&ast.BasicLit{
+					Kind:  token.INT,
+					Value: "1",
+				},
+			},
+		},
+		{
+			"FuncDecl Ident:not(@Name, @Fun)",
+			MustParse(`package foo
+			func f(a int) {
+				g(a, 1, "b")
+			}
+			`),
+			args{
+				query.MustParse("FuncDecl Ident:not(@Name, @Fun)"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "a"},
+				&ast.Ident{Name: "int"},
+				&ast.Ident{Name: "a"},
+			},
+		},
 		{
 			"File:root",
 			MustParse(`package foo
@@ -589,6 +1184,69 @@ func TestNode_QuerySelectorAll(t *testing.T) {
 			},
 			[]ast.Node{},
 		},
+		{
+			"Nested BlockStmt > ReturnStmt",
+			MustParse(`package foo
+			func f() {
+				if true {
+					return
+				}
+			}
+			`),
+			args{
+				query.MustParse("BlockStmt > ReturnStmt"),
+			},
+			[]ast.Node{
+				&ast.ReturnStmt{},
+			},
+		},
+		{
+			"Nested FuncDecl CallExpr",
+			MustParse(`package foo
+			func f() {
+				g(h())
+			}
+			`),
+			args{
+				query.MustParse("FuncDecl CallExpr"),
+			},
+			[]ast.Node{
+				&ast.CallExpr{
+					Fun: &ast.Ident{Name: "g"},
+				},
+				&ast.CallExpr{
+					Fun: &ast.Ident{Name: "h"},
+				},
+			},
+		},
+		{
+			"TypeSpec:has(> StructType)",
+			MustParse(`package foo
+			type s struct {}
+			type i interface {}
+			`),
+			args{
+				query.MustParse("TypeSpec:has(> StructType)"),
+			},
+			[]ast.Node{
+				&ast.TypeSpec{
+					Name: &ast.Ident{Name: "s"},
+				},
+			},
+		},
+		{
+			"BinaryExpr > Ident[Name=$x] + Ident[Name=$x]",
+			MustParse(`package foo
+			var a = b == b
+			var c = b == d
+			`),
+			args{
+				query.MustParse("BinaryExpr > Ident[Name=$x] + Ident[Name=$x]"),
+			},
+			[]ast.Node{
+				&ast.Ident{Name: "b"},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -606,6 +1264,232 @@ func TestNode_QuerySelectorAll(t *testing.T) {
 	}
 }
 
+func TestParseNode_Field(t *testing.T) {
+	n := MustParse(`package main
+	func f() {
+		g(a, b)
+	}
+	`)
+	funcDecl := n.Children[1]
+	assert.Equal(t, "Decls", funcDecl.Field)
+	assert.Equal(t, 0, funcDecl.FieldIndex)
+	assert.Equal(t, "Name", funcDecl.Children[0].Field)
+	assert.Equal(t, -1, funcDecl.Children[0].FieldIndex)
+
+	callExpr := funcDecl.Children[2].Children[0].Children[0]
+	assert.Equal(t, "CallExpr", callExpr.Name)
+	assert.Equal(t, "Fun", callExpr.Children[0].Field)
+	assert.Equal(t, "Args", callExpr.Children[2].Field)
+	assert.Equal(t, 1, callExpr.Children[2].FieldIndex)
+}
+
+func largeSliceSource(n int) string {
+	var b strings.Builder
+	b.WriteString("package main\n\nvar v = []int{\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "\t%d,\n", i)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func TestParseNode_FieldOfLargeSlice(t *testing.T) {
+	// fields of children are computed once per parent, so this takes milliseconds
+	n := MustParse(largeSliceSource(40000))
+	elts := n.SelectAll(query.MustParse("CompositeLit > BasicLit@Elts"))
+	if assert.Len(t, elts, 40000) {
+		last := elts[len(elts)-1]
+		assert.Equal(t, "Elts", last.Field)
+		assert.Equal(t, 39999, last.FieldIndex)
+		assert.Equal(t, "39999", last.Node.(*ast.BasicLit).Value)
+	}
+}
+
+func BenchmarkParse_LargeSlice(b *testing.B) {
+	source := largeSliceSource(40000)
+	for i := 0; i < b.N; i++ {
+		MustParse(source)
+	}
+}
+
+func TestNode_Select(t *testing.T) {
+	n := MustParse(`package main
+	func f() {
+		g(a, b)
+	}
+	`)
+	callExpr := n.Select(query.MustParse("CallExpr"))
+	if !assert.NotNil(t, callExpr) {
+		return
+	}
+	assert.Equal(t, "CallExpr", callExpr.Name)
+	assert.Nil(t, n.Select(query.MustParse("GenDecl")))
+
+	// chain query from the matched node
+	args := callExpr.SelectAll(query.MustParse("*@Args"))
+	if !assert.Len(t, args, 2) {
+		return
+	}
+	assert.Equal(t, "a", args[0].Node.(*ast.Ident).Name)
+	assert.Equal(t, "b", args[1].Node.(*ast.Ident).Name)
+	assert.Equal(t, callExpr, args[0].Parent)
+	assert.Equal(t, args[0], args[1].PrevSibling())
+	assert.Equal(t, callExpr.Children[0], args[0].PrevSibling())
+	assert.Nil(t, callExpr.Children[0].PrevSibling())
+	assert.Nil(t, n.PrevSibling())
+
+	ancestors := args[0].Ancestors()
+	names := []string{}
+	for _, ancestor := range ancestors {
+		names = append(names, ancestor.Name)
+	}
+	assert.Equal(t, []string{"CallExpr", "ExprStmt", "BlockStmt", "FuncDecl", "File"}, names)
+	assert.Empty(t, n.Ancestors())
+}
+
+func TestNode_SelectAll_DocumentOrder(t *testing.T) {
+	n := MustParse(`package main
+	func f() {
+		a := 1
+		g(a)
+		b := 2
+		h(b)
+	}
+	`)
+	q := query.MustParse("CallExpr > Ident@Fun, AssignStmt > Ident, Ident[Name='b']")
+	names := func(nodes []*Node) []string {
+		ret := []string{}
+		for _, node := range nodes {
+			ret = append(ret, node.Node.(*ast.Ident).Name)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"a", "g", "b", "h", "b"}, names(n.SelectAll(q)))
+	assert.Equal(t, "a", n.Select(q).Node.(*ast.Ident).Name)
+	assert.Equal(t, "a", n.QuerySelector(q).(*ast.Ident).Name)
+
+	groups := n.SelectAllBySelector(q)
+	if assert.Len(t, groups, 3) {
+		assert.Equal(t, []string{"g", "h"}, names(groups[0]))
+		assert.Equal(t, []string{"a", "b"}, names(groups[1]))
+		assert.Equal(t, []string{"b", "b"}, names(groups[2]))
+	}
+
+	// order is ast.Walk order, not position order. The name Ident of FuncDecl is walked before its sibling FuncType
+	// though FuncType starts at `func` keyword before the name
+	types := []string{}
+	for _, node := range n.SelectAll(query.MustParse("FuncType, FuncDecl > Ident")) {
+		types = append(types, node.Name)
+	}
+	assert.Equal(t, []string{"Ident", "FuncType"}, types)
+}
+
+func TestNode_Select_Metavariable(t *testing.T) {
+	n := MustParse(`package main
+	func f() { f(a) }
+	`)
+	tests := []string{
+		// the first found descendant `f` is bound in :has, so `a` does not match
+		"CallExpr:has(Ident[Name=$x]) > Ident@Args[Name=$x]",
+		"CallExpr:has(Ident@Fun[Name=$x]) > Ident@Args[Name=$x]",
+		"CallExpr:has(Ident[Name=$x]) Ident[Name=$x]",
+		"Ident[Name=$x], CallExpr > Ident@Args",
+	}
+	for _, q := range tests {
+		t.Run(q, func(t *testing.T) {
+			parsed := query.MustParse(q)
+			all := n.SelectAll(parsed)
+			if len(all) == 0 {
+				assert.Nil(t, n.Select(parsed))
+				assert.Nil(t, n.QuerySelector(parsed))
+				return
+			}
+			assert.Equal(t, all[0], n.Select(parsed))
+			assert.Equal(t, all[0].Node, n.QuerySelector(parsed))
+		})
+	}
+	assert.Empty(t, n.SelectAll(query.MustParse(tests[0])))
+}
+
+func TestNode_Matches(t *testing.T) {
+	n := MustParse(`package main
+	func f() {
+		go func() {
+			g(a)
+		}()
+		h(a)
+	}
+	`)
+	idents := n.SelectAll(query.MustParse("CallExpr > Ident@Args"))
+	if !assert.Len(t, idents, 2) {
+		return
+	}
+	inGo := query.MustParse("GoStmt FuncLit Ident")
+	assert.True(t, idents[0].Matches(inGo))
+	assert.False(t, idents[1].Matches(inGo))
+	// ancestors outside of the receiver are also matched
+	assert.True(t, idents[0].Matches(query.MustParse("FuncDecl Ident[Name='a']")))
+	assert.True(t, idents[1].Matches(query.MustParse("GoStmt + ExprStmt Ident, GenDecl")))
+
+	funcLit := idents[0].Closest(query.MustParse("FuncLit"))
+	if assert.NotNil(t, funcLit) {
+		assert.Equal(t, "FuncLit", funcLit.Name)
+	}
+	assert.Nil(t, idents[1].Closest(query.MustParse("FuncLit")))
+	assert.Equal(t, idents[1], idents[1].Closest(query.MustParse("Ident")))
+	funcDecl := idents[1].Closest(query.MustParse("FuncDecl:has(GoStmt)"))
+	if assert.NotNil(t, funcDecl) {
+		assert.Equal(t, "FuncDecl", funcDecl.Name)
+	}
+}
+
+func TestNode_Scope(t *testing.T) {
+	n := MustParse(`package main
+	func f() {
+		g(h(a))
+	}
+	`)
+	callExpr := n.Select(query.MustParse("CallExpr"))
+	if !assert.NotNil(t, callExpr) {
+		return
+	}
+	names := []string{}
+	for _, ident := range callExpr.SelectAll(query.MustParse(":scope > Ident")) {
+		names = append(names, ident.Node.(*ast.Ident).Name)
+	}
+	assert.Equal(t, []string{"g"}, names)
+	assert.Equal(t, []*Node{n}, n.SelectAll(query.MustParse(":scope")))
+
+	inner := callExpr.Select(query.MustParse("CallExpr CallExpr"))
+	if !assert.NotNil(t, inner) {
+		return
+	}
+	assert.True(t, inner.Matches(query.MustParse("CallExpr > :scope")))
+	assert.False(t, callExpr.Matches(query.MustParse("CallExpr > :scope")))
+	assert.Equal(t, callExpr, inner.Closest(query.MustParse("CallExpr:has(> :scope)")))
+	assert.Equal(t, inner, inner.Closest(query.MustParse(":scope")))
+}
+
+func TestNode_Path(t *testing.T) {
+	n := MustParse(`package main
+	func f() {
+		g(a, a)
+	}
+	`)
+	assert.Equal(t, "File:root", n.Path())
+	for _, ident := range n.SelectAll(query.MustParse("Ident")) {
+		q, err := query.Parse(ident.Path())
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, []*Node{ident}, n.SelectAll(q))
+	}
+	args := n.SelectAll(query.MustParse("*@Args"))
+	if assert.Len(t, args, 2) {
+		assert.Equal(t, "File:root > FuncDecl:nth-child(2) > BlockStmt:nth-child(3) > ExprStmt:nth-child(1) > CallExpr:nth-child(1) > Ident:nth-child(3)", args[1].Path())
+	}
+}
+
 func equalIdent(t *testing.T, n1 ast.Node, n2 ast.Node) bool {
 	sameType := assert.IsType(t, n1, n2)
 	if !sameType {
@@ -71,3 +71,83 @@ type User struct {
 	//	Age  int
 	// }
 }
+
+// Find self comparisons like `a == a` with metavariable.
+func ExampleNode_QueryMatches() {
+	source := `package main
+
+func f(a, b int) bool {
+	return a == a || a == b
+}`
+	q := query.MustParse("BinaryExpr:has(> Ident@X[Name=$x] + Ident@Y[Name=$x])")
+	node := gaq.MustParse(source)
+	for _, m := range node.QueryMatches(q) {
+		fmt.Printf("%s is compared with itself\n", m.Captures["x"].Value)
+	}
+	// Output:
+	// a is compared with itself
+}
+
+// Wrap matched calls and delete debug statements with Rewriter.
+func ExampleRewriter() {
+	source := `package main
+
+func f() error {
+	// debug
+	println("f")
+	return g()
+}`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", source, parser.ParseComments)
+	if err != nil {
+		log.Fatalf("Cannot parse source. %v", err)
+	}
+	node := gaq.MustParseNode(f)
+	r := gaq.NewRewriter(fset)
+	for _, n := range node.QuerySelectorAll(query.MustParse("ExprStmt:has(> CallExpr > Ident[Name='println'])")) {
+		r.Delete(n)
+	}
+	for _, n := range node.QuerySelectorAll(query.MustParse("ReturnStmt > CallExpr")) {
+		if err := r.Wrap(n, "wrap($node)"); err != nil {
+			log.Fatalf("Cannot wrap node. %v", err)
+		}
+	}
+	if _, err := r.Apply(f); err != nil {
+		log.Fatalf("Cannot rewrite node. %v", err)
+	}
+	var buf bytes.Buffer
+	err = format.Node(&buf, fset, f)
+	if err != nil {
+		log.Fatalf("Cannot format node. %v", err)
+	}
+	fmt.Println(buf.String())
+	// Output:
+	// package main
+	//
+	// func f() error {
+	//
+	//	return wrap(g())
+	// }
+}
+
+// Check the context of nodes found by other query with Matches and Closest.
+func ExampleNode_Closest() {
+	source := `package main
+
+func f(a int) {
+	go func() {
+		g(a)
+	}()
+	g(a)
+}`
+	node := gaq.MustParse(source)
+	inGoroutine := query.MustParse("GoStmt > CallExpr > FuncLit *:scope")
+	for _, ident := range node.SelectAll(query.MustParse("CallExpr > Ident@Args[Name='a']")) {
+		if ident.Matches(inGoroutine) {
+			funcDecl := ident.Closest(query.MustParse("FuncDecl"))
+			fmt.Printf("a is used in goroutine of %s\n", funcDecl.Node.(*ast.FuncDecl).Name.Name)
+		}
+	}
+	// Output:
+	// a is used in goroutine of f
+}
@@ -0,0 +1,95 @@
+package gaq
+
+import (
+	"sort"
+
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+// nodeIndex holds node and its descendants by node name in document order
+type nodeIndex struct {
+	all    []*Node
+	byName map[string][]*Node
+	order  map[*Node]int
+}
+
+// typeIndex returns the index of node and its descendants.
+// The index is built at the first call and not updated when children are modified.
+func (n *Node) typeIndex() *nodeIndex {
+	n.indexOnce.Do(func() {
+		index := &nodeIndex{byName: map[string][]*Node{}, order: map[*Node]int{}}
+		index.add(n)
+		n.index = index
+	})
+	return n.index
+}
+
+func (index *nodeIndex) add(n *Node) {
+	index.order[n] = len(index.all)
+	index.all = append(index.all, n)
+	index.byName[n.Name] = append(index.byName[n.Name], n)
+	for _, child := range n.Children {
+		index.add(child)
+	}
+}
+
+// candidates returns nodes which can match with selector
+func (index *nodeIndex) candidates(cs *query.CompiledSelector) []*Node {
+	if cs.Type == "" {
+		return index.all
+	}
+	return index.byName[cs.Type]
+}
+
+// SelectCompiled queries to node by compiled query and return the first matched *Node in document order
+func (n *Node) SelectCompiled(m *query.Matcher) *Node {
+	index := n.typeIndex()
+	var firstNode *Node
+	c := newMatchContext(n)
+	for _, cs := range m.Selectors {
+		for _, candidate := range index.candidates(cs) {
+			if firstNode != nil && index.order[candidate] >= index.order[firstNode] {
+				break
+			}
+			if n.isMatchCandidate(c, candidate, cs) {
+				firstNode = candidate
+				break
+			}
+		}
+	}
+	return firstNode
+}
+
+// SelectAllCompiled queries to node by compiled query and return all matched *Node in document order.
+// Only nodes of the type of the rightmost compound selector are checked toward ancestors.
+// The matched nodes are the same as Walk.
+func (n *Node) SelectAllCompiled(m *query.Matcher) []*Node {
+	index := n.typeIndex()
+	nodes := []*Node{}
+	addedNodes := map[*Node]bool{}
+	c := newMatchContext(n)
+	for _, cs := range m.Selectors {
+		for _, candidate := range index.candidates(cs) {
+			if _, ok := addedNodes[candidate]; ok {
+				continue
+			}
+			if n.isMatchCandidate(c, candidate, cs) {
+				nodes = append(nodes, candidate)
+				addedNodes[candidate] = true
+			}
+		}
+	}
+	if len(m.Selectors) > 1 {
+		sort.Slice(nodes, func(i, j int) bool {
+			return index.order[nodes[i]] < index.order[nodes[j]]
+		})
+	}
+	return nodes
+}
+
+// isMatchCandidate checks candidate toward ancestors and binds metavariables from left to right like SelectAll
+func (n *Node) isMatchCandidate(c *matchContext, candidate *Node, cs *query.CompiledSelector) bool {
+	s := cs.Selector
+	chain := make([]*Node, len(s.SimpleSelectors))
+	return candidate.findChain(c, s, len(s.SimpleSelectors)-1, chain, n)
+}
@@ -0,0 +1,132 @@
+package gaq
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestNode_SelectAllCompiled(t *testing.T) {
+	n := MustParse(`package foo
+	func f(a, b int) error {
+		if a == a {
+			g(a, b)
+		}
+		go func() {
+			h(b)
+		}()
+		fmt.Sprintf("%d", a)
+		return nil
+	}
+	`)
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"Type", "Ident"},
+		{"Descendant", "FuncDecl Ident"},
+		{"Child", "CallExpr > Ident"},
+		{"Adjacent sibling", "Ident + Ident"},
+		{"General sibling", "IfStmt ~ *"},
+		{"Field", "CallExpr > *@Args"},
+		{"Attribute path", "CallExpr[Fun.Sel.Name='Sprintf']"},
+		{"Has", "BlockStmt:has(> ExprStmt CallExpr[Fun.Name='h'])"},
+		{"Metavariable", "BinaryExpr > Ident[Name=$x] + Ident[Name=$x]"},
+		{"Has with back-reference", "CallExpr:has(Ident[Name=$x]) > Ident@Args[Name=$x]"},
+		{"Has with descendant back-reference", "FuncDecl:has(Ident@Names[Name=$x]) CallExpr > Ident@Args[Name=$x]"},
+		{"Selector list", "ReturnStmt, CallExpr > Ident, Ident[Name='b']"},
+		{"Not matched", "GenDecl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := query.MustParse(tt.query)
+			m := query.Compile(q)
+			want := n.SelectAll(q)
+			assert.Equal(t, want, n.SelectAllCompiled(m))
+			if len(want) > 0 {
+				assert.Equal(t, want[0], n.SelectCompiled(m))
+			} else {
+				assert.Nil(t, n.SelectCompiled(m))
+			}
+		})
+	}
+
+	m := query.Compile(query.MustParsePattern("fmt.Sprintf($fmt, $*args)"))
+	assert.Equal(t, n.SelectAll(m.Query), n.SelectAllCompiled(m))
+}
+
+func TestNode_SelectAllCompiled_Source(t *testing.T) {
+	source, err := ioutil.ReadFile("testdata/parity/parity.go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	n := MustParse(string(source))
+	queries := []string{
+		"CallExpr:has(Ident[Name=$x]) > Ident@Args[Name=$x]",
+		"FuncDecl:has(> FieldList Ident[Name=$x]) ReturnStmt Ident[Name=$x]",
+		"AssignStmt > Ident@Lhs[Name=$x] ~ CallExpr Ident[Name=$x]",
+	}
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			parsed := query.MustParse(q)
+			want := n.SelectAll(parsed)
+			assert.NotEmpty(t, want)
+			assert.Equal(t, want, n.SelectAllCompiled(query.Compile(parsed)))
+		})
+	}
+}
+
+func benchmarkSource() string {
+	var b strings.Builder
+	b.WriteString("package foo\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, `
+func f%d(a, b int) error {
+	if a == b {
+		return fmt.Errorf("%%d", a)
+	}
+	for i := 0; i < a; i++ {
+		g(i, b)
+	}
+	return nil
+}
+`, i)
+	}
+	return b.String()
+}
+
+var benchmarkQueries = []string{
+	"CallExpr[Fun.Sel.Name='Errorf']",
+	"FuncDecl IfStmt ReturnStmt > CallExpr",
+	"ForStmt CallExpr > Ident@Args + Ident",
+	"CallExpr:has(Ident[Name=$x]) > Ident@Args[Name=$x]",
+	"* * * * * * * Ident",
+}
+
+func BenchmarkNode_SelectAll(b *testing.B) {
+	n := MustParse(benchmarkSource())
+	for _, q := range benchmarkQueries {
+		parsed := query.MustParse(q)
+		b.Run(q, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				n.SelectAll(parsed)
+			}
+		})
+	}
+}
+
+func BenchmarkNode_SelectAllCompiled(b *testing.B) {
+	n := MustParse(benchmarkSource())
+	for _, q := range benchmarkQueries {
+		m := query.Compile(query.MustParse(q))
+		b.Run(q, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				n.SelectAllCompiled(m)
+			}
+		})
+	}
+}
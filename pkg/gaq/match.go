@@ -0,0 +1,192 @@
+package gaq
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+// Capture represents the value bound to metavariable like `$x`
+type Capture struct {
+	Name string
+	// Value is the attribute value, or the formatted source of nodes bound in pattern
+	Value string
+	// Node is the node whose attribute is bound, or the node bound to `$x` in pattern
+	Node *Node
+	// Nodes are the nodes bound to `$*x` in pattern
+	Nodes []*Node
+
+	// pattern is true if nodes are bound in pattern
+	pattern bool
+}
+
+// Match represents matched node with captured metavariables
+type Match struct {
+	Node     *Node
+	Captures map[string]*Capture
+}
+
+// QueryMatches queries to node and return all matched nodes with captured metavariables in document order.
+// If the same node is matched several times, captures of the first match by the first selector are returned.
+func (n *Node) QueryMatches(q *query.Query) []*Match {
+	matches := []*Match{}
+	addedNodes := map[*Node]bool{}
+	for _, group := range n.QueryMatchesBySelector(q) {
+		for _, m := range group {
+			if _, ok := addedNodes[m.Node]; !ok {
+				matches = append(matches, m)
+				addedNodes[m.Node] = true
+			}
+		}
+	}
+	if len(q.Selectors) > 1 {
+		sortMatchesByDocumentOrder(matches)
+	}
+	return matches
+}
+
+// QueryMatchesBySelector queries to node and return matches grouped by selector in query.
+// Each group is in document order, and the same node can be in several groups.
+func (n *Node) QueryMatchesBySelector(q *query.Query) [][]*Match {
+	groups := [][]*Match{}
+	c := newMatchContext(n)
+	for _, selector := range q.Selectors {
+		matches := []*Match{}
+		addedNodes := map[*Node]bool{}
+		c.visited = newVisited(selector)
+		n.apply(c, selector, 0, 0, -1, func(n *Node) bool {
+			if _, ok := addedNodes[n]; !ok {
+				matches = append(matches, &Match{Node: n, Captures: c.snapshot()})
+				addedNodes[n] = true
+			}
+			return true
+		})
+		sortMatchesByDocumentOrder(matches)
+		groups = append(groups, matches)
+	}
+	return groups
+}
+
+// sortMatchesByDocumentOrder sorts matches in the order of depth-first traversal, where parent precedes its children
+func sortMatchesByDocumentOrder(matches []*Match) {
+	paths := map[*Node][]int{}
+	for _, m := range matches {
+		paths[m.Node] = m.Node.indexPath()
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return compareIndexPath(paths[matches[i].Node], paths[matches[j].Node]) < 0
+	})
+}
+
+// indexPath returns indexes of node and its ancestors among siblings from the root
+func (n *Node) indexPath() []int {
+	depth := 0
+	for node := n; node.Parent != nil; node = node.Parent {
+		depth++
+	}
+	path := make([]int, depth)
+	for node := n; node.Parent != nil; node = node.Parent {
+		depth--
+		path[depth] = node.Index
+	}
+	return path
+}
+
+// compareIndexPath compares index paths in document order. Ancestor precedes its descendants.
+func compareIndexPath(a []int, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return len(a) - len(b)
+}
+
+// matchContext holds metavariables bound while matching a selector.
+// Bindings are undone by rollback when the match is backtracked.
+// scope is the node which is queried and matched by `:scope`.
+// visited holds nodes visited by apply from the same node with the same callback if selector has no metavariable.
+// Then visiting again yields the same matches.
+type matchContext struct {
+	captures map[string]*Capture
+	bound    []string
+	scope    *Node
+	visited  map[visit]bool
+}
+
+// visit represents node visited by apply at selector index
+type visit struct {
+	selector      *query.Selector
+	node          *Node
+	selectorIndex int
+}
+
+// newVisited returns the map of visited nodes for apply with selector, or nil if selector has metavariables
+func newVisited(selector *query.Selector) map[visit]bool {
+	if selector.HasVariables() {
+		return nil
+	}
+	return map[visit]bool{}
+}
+
+func newMatchContext(scope *Node) *matchContext {
+	return &matchContext{captures: map[string]*Capture{}, scope: scope}
+}
+
+func (c *matchContext) mark() int {
+	return len(c.bound)
+}
+
+func (c *matchContext) rollback(mark int) {
+	for _, name := range c.bound[mark:] {
+		delete(c.captures, name)
+	}
+	c.bound = c.bound[:mark]
+}
+
+// bind binds value to variable if not bound yet, otherwise compares value with the bound one.
+// `$_` matches any value and is never bound.
+func (c *matchContext) bind(variable string, value string, n *Node, foldsCase bool) bool {
+	name := strings.TrimPrefix(variable, "$")
+	if name == "_" {
+		return true
+	}
+	if captured, ok := c.captures[name]; ok {
+		if foldsCase {
+			return foldCase(captured.Value) == foldCase(value)
+		}
+		return captured.Value == value
+	}
+	c.add(&Capture{Name: name, Value: value, Node: n})
+	return true
+}
+
+func (c *matchContext) add(captured *Capture) {
+	c.captures[captured.Name] = captured
+	c.bound = append(c.bound, captured.Name)
+}
+
+// since returns captures bound after mark
+func (c *matchContext) since(mark int) []*Capture {
+	captures := []*Capture{}
+	for _, name := range c.bound[mark:] {
+		captures = append(captures, c.captures[name])
+	}
+	return captures
+}
+
+// restore binds captures returned by since again
+func (c *matchContext) restore(captures []*Capture) {
+	for _, captured := range captures {
+		c.add(captured)
+	}
+}
+
+func (c *matchContext) snapshot() map[string]*Capture {
+	captures := map[string]*Capture{}
+	for name, captured := range c.captures {
+		captures[name] = captured
+	}
+	return captures
+}
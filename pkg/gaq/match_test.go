@@ -0,0 +1,93 @@
+package gaq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestNode_QueryMatches(t *testing.T) {
+	n := MustParse(`package foo
+	func f() {
+		x = x
+		x = y
+		_ = a == a
+		_ = a == b
+		_ = A == a
+	}
+	`)
+	type capture struct {
+		name  string
+		value string
+	}
+	tests := []struct {
+		name string
+		q    string
+		want [][]capture
+	}{
+		{
+			"Self assignment",
+			"AssignStmt:has(> Ident@Lhs[Name=$x] ~ Ident@Rhs[Name=$x])",
+			[][]capture{
+				{{"x", "x"}},
+			},
+		},
+		{
+			"Self comparison",
+			"BinaryExpr:has(> @X[Name=$x] + @Y[Name=$x])",
+			[][]capture{
+				{{"x", "a"}},
+			},
+		},
+		{
+			"Case insensitive back-reference",
+			"BinaryExpr:has(> @X[Name=$x i] + @Y[Name=$x i])",
+			[][]capture{
+				{{"x", "a"}},
+				{{"x", "A"}},
+			},
+		},
+		{
+			"Multiple variables",
+			"AssignStmt:has(> Ident@Lhs[Name=$lhs] ~ Ident@Rhs[Name=$rhs])",
+			[][]capture{
+				{{"lhs", "x"}, {"rhs", "x"}},
+				{{"lhs", "x"}, {"rhs", "y"}},
+			},
+		},
+		{
+			"Wildcard is not captured",
+			"BinaryExpr:has(> @X[Name=$_] + @Y[Name=$_])",
+			[][]capture{
+				{},
+				{},
+				{},
+			},
+		},
+		{
+			"Not bound in :not",
+			"BinaryExpr:not(:has(> @X[Name=$x] + @Y[Name=$x]))",
+			[][]capture{
+				{},
+				{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := n.QueryMatches(query.MustParse(tt.q))
+			if !assert.Len(t, got, len(tt.want)) {
+				return
+			}
+			for i, want := range tt.want {
+				assert.Len(t, got[i].Captures, len(want))
+				for _, c := range want {
+					if assert.Contains(t, got[i].Captures, c.name) {
+						assert.Equal(t, c.value, got[i].Captures[c.name].Value)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package gaq
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"strings"
+
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+var (
+	posType         = reflect.TypeOf(token.NoPos)
+	objectType      = reflect.TypeOf(&ast.Object{})
+	scopeType       = reflect.TypeOf(&ast.Scope{})
+	commentType     = reflect.TypeOf(&ast.CommentGroup{})
+	commentListType = reflect.TypeOf([]*ast.CommentGroup{})
+)
+
+// patternMatcher matches go code pattern with node structurally.
+// Positions, comments and resolved objects are ignored, except that `...` of call is compared.
+type patternMatcher struct {
+	c    *matchContext
+	root *Node
+	// holes is false when both sides are real code, e.g. comparing with bound nodes
+	holes bool
+}
+
+func (n *Node) isMatchOptionPattern(c *matchContext, p *query.Pattern) bool {
+	if p == nil {
+		return true
+	}
+	m := &patternMatcher{c: c, root: n, holes: true}
+	return m.match(reflect.ValueOf(p.Node), reflect.ValueOf(n.Node))
+}
+
+// equalNode reports whether two nodes have the same structure
+func equalNode(n1 ast.Node, n2 ast.Node) bool {
+	m := &patternMatcher{c: newMatchContext(nil)}
+	return m.match(reflect.ValueOf(n1), reflect.ValueOf(n2))
+}
+
+func (m *patternMatcher) variable(v reflect.Value) (string, bool, bool) {
+	if !m.holes || !v.IsValid() || !v.CanInterface() {
+		return "", false, false
+	}
+	node, ok := v.Interface().(ast.Node)
+	if !ok {
+		return "", false, false
+	}
+	return query.PatternVariable(node)
+}
+
+func (m *patternMatcher) match(p reflect.Value, t reflect.Value) bool {
+	if name, list, ok := m.variable(p); ok && !list {
+		if isNilValue(t) {
+			return false
+		}
+		return m.bind(name, []ast.Node{t.Interface().(ast.Node)}, false)
+	}
+	switch p.Kind() {
+	case reflect.Interface:
+		if p.IsNil() || t.IsNil() {
+			return p.IsNil() && t.IsNil()
+		}
+		return m.match(p.Elem(), t.Elem())
+	case reflect.Ptr:
+		if p.IsNil() || t.IsNil() {
+			return p.IsNil() && t.IsNil()
+		}
+		if p.Type() != t.Type() {
+			return false
+		}
+		return m.match(p.Elem(), t.Elem())
+	case reflect.Struct:
+		if p.Type() != t.Type() {
+			return false
+		}
+		for i := 0; i < p.NumField(); i++ {
+			switch p.Field(i).Type() {
+			case posType:
+				// position of `...` in call like `append(a, b...)` is not only position but syntax
+				if p.Type().Field(i).Name == "Ellipsis" && p.Field(i).Interface().(token.Pos).IsValid() != t.Field(i).Interface().(token.Pos).IsValid() {
+					return false
+				}
+				continue
+			case objectType, scopeType, commentType, commentListType:
+				continue
+			}
+			if !m.match(p.Field(i), t.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		return m.matchList(p, 0, t, 0)
+	}
+	return p.Type() == t.Type() && p.Interface() == t.Interface()
+}
+
+// matchList matches list elements from i of pattern and j of target.
+// `$*x` is tried with the shortest elements first.
+func (m *patternMatcher) matchList(p reflect.Value, i int, t reflect.Value, j int) bool {
+	if i == p.Len() {
+		return j == t.Len()
+	}
+	if name, list, ok := m.variable(p.Index(i)); ok && list {
+		for k := j; k <= t.Len(); k++ {
+			nodes := []ast.Node{}
+			for l := j; l < k; l++ {
+				nodes = append(nodes, t.Index(l).Interface().(ast.Node))
+			}
+			mark := m.c.mark()
+			if m.bind(name, nodes, true) && m.matchList(p, i+1, t, k) {
+				return true
+			}
+			m.c.rollback(mark)
+		}
+		return false
+	}
+	if j == t.Len() {
+		return false
+	}
+	mark := m.c.mark()
+	if m.match(p.Index(i), t.Index(j)) && m.matchList(p, i+1, t, j+1) {
+		return true
+	}
+	m.c.rollback(mark)
+	return false
+}
+
+// bind binds nodes to metavariable, or compares nodes with the bound ones structurally.
+// `$_` and `$*_` match any nodes and are never bound.
+func (m *patternMatcher) bind(name string, nodes []ast.Node, list bool) bool {
+	if name == "_" {
+		return true
+	}
+	if captured, ok := m.c.captures[name]; ok {
+		if !captured.pattern {
+			return len(nodes) == 1 && captured.Value == formatNodes(nodes)
+		}
+		boundNodes := captured.Nodes
+		if captured.Node != nil {
+			boundNodes = []*Node{captured.Node}
+		}
+		if len(boundNodes) != len(nodes) {
+			return false
+		}
+		for i, bound := range boundNodes {
+			if !equalNode(bound.Node, nodes[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	captured := &Capture{Name: name, Value: formatNodes(nodes), pattern: true}
+	if list {
+		captured.Nodes = []*Node{}
+		for _, node := range nodes {
+			captured.Nodes = append(captured.Nodes, m.root.find(node))
+		}
+	} else {
+		captured.Node = m.root.find(nodes[0])
+	}
+	m.c.add(captured)
+	return true
+}
+
+// find returns the descendant which holds node
+func (n *Node) find(node ast.Node) *Node {
+	if n.Node == node {
+		return n
+	}
+	for _, child := range n.Children {
+		if child.Pos <= int(node.Pos()) && int(node.End()) <= child.End {
+			if found := child.find(node); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// formatNodes formats nodes as go code. Statements are joined by newline, others are joined by comma.
+func formatNodes(nodes []ast.Node) string {
+	values := []string{}
+	separator := ", "
+	for _, node := range nodes {
+		if _, ok := node.(ast.Stmt); ok {
+			separator = "\n"
+		}
+		values = append(values, formatNode(node))
+	}
+	return strings.Join(values, separator)
+}
+
+func formatNode(node ast.Node) string {
+	// go/printer does not support *ast.Field
+	if field, ok := node.(*ast.Field); ok {
+		value := formatNode(field.Type)
+		if len(field.Names) > 0 {
+			names := []string{}
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			value = strings.Join(names, ", ") + " " + value
+		}
+		if field.Tag != nil {
+			value += " " + field.Tag.Value
+		}
+		return value
+	}
+	var buf bytes.Buffer
+	printer.Fprint(&buf, token.NewFileSet(), node)
+	return buf.String()
+}
@@ -0,0 +1,138 @@
+package gaq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestNode_QueryMatches_Pattern(t *testing.T) {
+	n := MustParse(`package foo
+	func f(a, b int) error {
+		fmt.Sprintf("%d", a)
+		fmt.Sprintf("%d %d", a, b)
+		fmt.Sprint(a)
+		x = x
+		x = y
+		xs = append(xs, y)
+		xs = append(xs, ys...)
+		if a.b == a.b {
+		}
+		err := g()
+		if err != nil {
+			return err
+		}
+		if err != nil {
+			log.Print(err)
+		}
+		return nil
+	}
+	`)
+	tests := []struct {
+		name     string
+		pattern  string
+		wantText []map[string]string
+	}{
+		{
+			"Call with list metavariable",
+			"fmt.Sprintf($fmt, $*args)",
+			[]map[string]string{
+				{"fmt": `"%d"`, "args": "a"},
+				{"fmt": `"%d %d"`, "args": "a, b"},
+			},
+		},
+		{
+			"Exact arguments",
+			"fmt.Sprintf($fmt, $a, $b)",
+			[]map[string]string{
+				{"fmt": `"%d %d"`, "a": "a", "b": "b"},
+			},
+		},
+		{
+			"Self assignment",
+			"$x = $x",
+			[]map[string]string{
+				{"x": "x"},
+			},
+		},
+		{
+			"Self comparison of expression",
+			"$x == $x",
+			[]map[string]string{
+				{"x": "a.b"},
+			},
+		},
+		{
+			"Call without ellipsis",
+			"append($x, $y)",
+			[]map[string]string{
+				{"x": "xs", "y": "y"},
+			},
+		},
+		{
+			"Call with ellipsis",
+			"append($x, $y...)",
+			[]map[string]string{
+				{"x": "xs", "y": "ys"},
+			},
+		},
+		{
+			"Statement",
+			"if $err != nil { return $*_ }",
+			[]map[string]string{
+				{"err": "err"},
+			},
+		},
+		{
+			"Statement list",
+			"if $err != nil { $*body }",
+			[]map[string]string{
+				{"err": "err", "body": "return err"},
+				{"err": "err", "body": "log.Print(err)"},
+			},
+		},
+		{
+			"Declaration",
+			"func $name($*params) error { $*_ }",
+			[]map[string]string{
+				{"name": "f", "params": "a, b int"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := n.QueryMatches(query.MustParsePattern(tt.pattern))
+			if !assert.Len(t, got, len(tt.wantText)) {
+				return
+			}
+			for i, want := range tt.wantText {
+				values := map[string]string{}
+				for name, captured := range got[i].Captures {
+					values[name] = captured.Value
+				}
+				assert.Equal(t, want, values)
+			}
+		})
+	}
+}
+
+func TestNode_QueryMatches_PatternNodes(t *testing.T) {
+	n := MustParse(`package foo
+	func f() {
+		g(a, b)
+	}
+	`)
+	got := n.QueryMatches(query.MustParsePattern("g($first, $*rest)"))
+	if !assert.Len(t, got, 1) {
+		return
+	}
+	first := got[0].Captures["first"]
+	assert.Equal(t, "Ident", first.Node.Name)
+	assert.Equal(t, "Args", first.Node.Field)
+	rest := got[0].Captures["rest"]
+	assert.Nil(t, rest.Node)
+	if assert.Len(t, rest.Nodes, 1) {
+		assert.Equal(t, 1, rest.Nodes[0].FieldIndex)
+	}
+}
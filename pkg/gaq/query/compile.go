@@ -0,0 +1,31 @@
+package query
+
+// Matcher represents the compiled query.
+// Selectors are matched from the nodes of the type of their rightmost compound selector toward ancestors.
+type Matcher struct {
+	Query     *Query
+	Selectors []*CompiledSelector
+}
+
+// CompiledSelector represents the selector with the type of its rightmost compound selector
+type CompiledSelector struct {
+	Selector *Selector
+	// Type is the node name of the rightmost compound selector like `CallExpr`.
+	// Empty if any node type can match, e.g. `*` or `@Args`.
+	Type string
+}
+
+// Compile compiles query to Matcher. q is not modified.
+func Compile(q *Query) *Matcher {
+	m := &Matcher{Query: q}
+	for _, selector := range q.Selectors {
+		rightmost := selector.SimpleSelectors[len(selector.SimpleSelectors)-1]
+		cs := &CompiledSelector{Selector: selector}
+		if rightmost.Name != "*" {
+			cs.Type = rightmost.Name
+		}
+		m.Selectors = append(m.Selectors, cs)
+	}
+	return m
+}
+
@@ -0,0 +1,41 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantTypes []string
+	}{
+		{"Type", "FuncDecl CallExpr", []string{"CallExpr"}},
+		{"Any type", "CallExpr > *", []string{""}},
+		{"Field only", "CallExpr > @Args", []string{""}},
+		{"Selector list", "CallExpr, File > Ident:first-child", []string{"CallExpr", "Ident"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := MustParse(tt.query)
+			m := Compile(q)
+			assert.Equal(t, q, m.Query)
+			types := []string{}
+			for i, cs := range m.Selectors {
+				assert.Equal(t, q.Selectors[i], cs.Selector)
+				types = append(types, cs.Type)
+			}
+			assert.Equal(t, tt.wantTypes, types)
+		})
+	}
+}
+
+func TestCompile_DoesNotModifyQuery(t *testing.T) {
+	q := MustParse("CallExpr[Fun.Sel.Name='Println']:has(Ident[Name='a'])")
+	want := MustParse("CallExpr[Fun.Sel.Name='Println']:has(Ident[Name='a'])")
+	m := Compile(q)
+	assert.Equal(t, q, m.Query)
+	assert.Equal(t, want, q)
+}
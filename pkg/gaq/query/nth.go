@@ -0,0 +1,103 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Nth represents `an+b` expression of nth pseudo
+type Nth struct {
+	Pos lexer.Position
+
+	A int
+	B int
+}
+
+// Parse parses `an+b`, `odd` or `even` tokens.
+// Tokens are consumed until `of` or non expression token.
+func (nth *Nth) Parse(lex lexer.PeekingLexer) error {
+	symbols := queryLexer.Symbols()
+	expression := ""
+	for {
+		token, err := lex.Peek(0)
+		if err != nil {
+			return err
+		}
+		if expression == "" {
+			nth.Pos = token.Pos
+		}
+		if token.Type == symbols["Ident"] && token.Value == "of" {
+			break
+		}
+		if token.Type != symbols["Ident"] && token.Type != symbols["Number"] && token.Value != "+" && token.Value != "-" {
+			break
+		}
+		expression += token.Value
+		if _, err := lex.Next(); err != nil {
+			return err
+		}
+	}
+	if expression == "" {
+		return lexer.Errorf(nth.Pos, "an+b expression is expected")
+	}
+	a, b, err := parseNth(expression)
+	if err != nil {
+		return lexer.Errorf(nth.Pos, "%v", err)
+	}
+	nth.A = a
+	nth.B = b
+	return nil
+}
+
+func parseNth(expression string) (int, int, error) {
+	switch strings.ToLower(expression) {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	i := strings.IndexAny(expression, "nN")
+	if i < 0 {
+		b, err := strconv.Atoi(expression)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid an+b expression %q", expression)
+		}
+		return 0, b, nil
+	}
+	var a, b int
+	switch aPart := expression[:i]; aPart {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		var err error
+		a, err = strconv.Atoi(aPart)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid an+b expression %q", expression)
+		}
+	}
+	if bPart := expression[i+1:]; bPart != "" {
+		if bPart[0] != '+' && bPart[0] != '-' {
+			return 0, 0, fmt.Errorf("invalid an+b expression %q", expression)
+		}
+		var err error
+		b, err = strconv.Atoi(bPart)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid an+b expression %q", expression)
+		}
+	}
+	return a, b, nil
+}
+
+// Match returns whether 1-based index is represented by `an+b` for some non-negative n
+func (nth *Nth) Match(index int) bool {
+	if nth.A == 0 {
+		return index == nth.B
+	}
+	diff := index - nth.B
+	return diff%nth.A == 0 && diff/nth.A >= 0
+}
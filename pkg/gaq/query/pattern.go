@@ -0,0 +1,174 @@
+package query
+
+import (
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/scanner"
+	"go/token"
+	"log"
+	"reflect"
+	"strings"
+)
+
+const (
+	patternVariablePrefix     = "__gaq_var_"
+	patternListVariablePrefix = "__gaq_list_"
+)
+
+// Pattern represents go code with metavariables.
+// It is set to SimpleSelectorOption by ParsePattern.
+type Pattern struct {
+	Source string
+	Node   ast.Node
+}
+
+// ParsePattern parses go code pattern and returns query which selects nodes matched with it.
+// Pattern must be a single expression, statement or declaration.
+// `$x` matches any node and binds it to x, `$*x` matches any number of nodes in list like arguments or statements.
+func ParsePattern(src string) (*Query, error) {
+	node, err := ParsePatternNode(src)
+	if err != nil {
+		return nil, err
+	}
+	name := "*"
+	if variable, list, ok := PatternVariable(node); !ok {
+		name = reflect.Indirect(reflect.ValueOf(node)).Type().Name()
+	} else if list {
+		return nil, fmt.Errorf("list metavariable $*%s cannot be the whole pattern", variable)
+	}
+	return &Query{
+		Selectors: []*Selector{
+			{
+				SimpleSelectors: []*SimpleSelector{
+					{
+						Name: name,
+						Options: []*SimpleSelectorOption{
+							{Pattern: &Pattern{Source: src, Node: node}},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// MustParsePattern parses go code pattern and returns query
+// If failed to parse, fatal occurs
+func MustParsePattern(src string) *Query {
+	query, err := ParsePattern(src)
+	if err != nil {
+		log.Fatalf("Cannot parse pattern. %v", err)
+	}
+	return query
+}
+
+// ParsePatternNode parses go code pattern and returns its ast.
+// Metavariables are parsed as identifiers which are detected by PatternVariable.
+func ParsePatternNode(src string) (ast.Node, error) {
+	replaced, err := replacePatternVariables(src)
+	if err != nil {
+		return nil, err
+	}
+	return parsePatternNode(replaced)
+}
+
+// PatternVariable returns metavariable name if node is metavariable in pattern.
+// list is true for `$*x`. Metavariable can be an identifier, an expression statement or an unnamed field.
+func PatternVariable(node ast.Node) (name string, list bool, ok bool) {
+	switch n := node.(type) {
+	case *ast.Ident:
+		if n == nil {
+			return "", false, false
+		}
+		if strings.HasPrefix(n.Name, patternListVariablePrefix) {
+			return strings.TrimPrefix(n.Name, patternListVariablePrefix), true, true
+		}
+		if strings.HasPrefix(n.Name, patternVariablePrefix) {
+			return strings.TrimPrefix(n.Name, patternVariablePrefix), false, true
+		}
+	case *ast.ExprStmt:
+		if n != nil {
+			return PatternVariable(n.X)
+		}
+	case *ast.Field:
+		if n != nil && len(n.Names) == 0 && n.Tag == nil {
+			return PatternVariable(n.Type)
+		}
+	}
+	return "", false, false
+}
+
+// replacePatternVariables replaces `$x` and `$*x` to identifiers so that pattern can be parsed as go code
+func replacePatternVariables(src string) (string, error) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, 0)
+
+	var b strings.Builder
+	last := 0
+	dollar := -1
+	list := false
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := file.Offset(pos)
+		nameOffset := dollar + 1
+		if list {
+			nameOffset++
+		}
+		switch {
+		case dollar < 0:
+			if tok == token.ILLEGAL && lit == "$" {
+				dollar = offset
+				list = false
+			}
+		case tok == token.MUL && !list && offset == dollar+1:
+			list = true
+		case tok == token.IDENT && offset == nameOffset:
+			prefix := patternVariablePrefix
+			if list {
+				prefix = patternListVariablePrefix
+			}
+			b.WriteString(src[last:dollar])
+			b.WriteString(prefix + lit)
+			last = offset + len(lit)
+			dollar = -1
+		default:
+			return "", fmt.Errorf("offset %d: metavariable name is expected after $", dollar)
+		}
+	}
+	if dollar >= 0 {
+		return "", fmt.Errorf("offset %d: metavariable name is expected after $", dollar)
+	}
+	b.WriteString(src[last:])
+	return b.String(), nil
+}
+
+// parsePatternNode parses src as expression, statement or declaration in this order
+func parsePatternNode(src string) (ast.Node, error) {
+	expr, exprErr := goparser.ParseExpr(src)
+	if exprErr == nil {
+		return expr, nil
+	}
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", "package p; func _() {\n"+src+"\n}", 0)
+	if err == nil {
+		stmts := f.Decls[0].(*ast.FuncDecl).Body.List
+		if len(stmts) == 1 {
+			return stmts[0], nil
+		}
+		return nil, fmt.Errorf("pattern must be a single statement but got %d statements", len(stmts))
+	}
+	f, err = goparser.ParseFile(fset, "", "package p\n"+src, 0)
+	if err == nil {
+		if len(f.Decls) == 1 {
+			return f.Decls[0], nil
+		}
+		return nil, fmt.Errorf("pattern must be a single declaration but got %d declarations", len(f.Decls))
+	}
+	return nil, fmt.Errorf("cannot parse pattern as expression, statement or declaration. %v", exprErr)
+}
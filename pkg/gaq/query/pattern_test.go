@@ -0,0 +1,130 @@
+package query
+
+import (
+	"go/ast"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantName string
+		wantType ast.Node
+		wantErr  bool
+	}{
+		{
+			"Expression",
+			"fmt.Sprintf($fmt, $*args)",
+			"CallExpr",
+			&ast.CallExpr{},
+			false,
+		},
+		{
+			"Statement",
+			"if $err != nil { return $*_ }",
+			"IfStmt",
+			&ast.IfStmt{},
+			false,
+		},
+		{
+			"Declaration",
+			"func $name() {}",
+			"FuncDecl",
+			&ast.FuncDecl{},
+			false,
+		},
+		{
+			"Metavariable only",
+			"$x",
+			"*",
+			&ast.Ident{},
+			false,
+		},
+		{
+			"List metavariable only",
+			"$*x",
+			"",
+			nil,
+			true,
+		},
+		{
+			"List metavariable statement only",
+			"$*x;",
+			"",
+			nil,
+			true,
+		},
+		{
+			"Dollar in string",
+			`fmt.Println("$x")`,
+			"CallExpr",
+			&ast.CallExpr{},
+			false,
+		},
+		{
+			"Invalid no name",
+			"$ + 1",
+			"",
+			nil,
+			true,
+		},
+		{
+			"Invalid space after $",
+			"$ x",
+			"",
+			nil,
+			true,
+		},
+		{
+			"Invalid multiple statements",
+			"a = b; c = d",
+			"",
+			nil,
+			true,
+		},
+		{
+			"Invalid go code",
+			"if $x {",
+			"",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePattern(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePattern() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			ss := got.Selectors[0].SimpleSelectors[0]
+			assert.Equal(t, tt.wantName, ss.Name)
+			assert.Equal(t, tt.src, ss.Options[0].Pattern.Source)
+			assert.IsType(t, tt.wantType, ss.Options[0].Pattern.Node)
+		})
+	}
+}
+
+func TestPatternVariable(t *testing.T) {
+	q := MustParsePattern("f($x, $*args)")
+	call := q.Selectors[0].SimpleSelectors[0].Options[0].Pattern.Node.(*ast.CallExpr)
+
+	name, list, ok := PatternVariable(call.Args[0])
+	assert.Equal(t, "x", name)
+	assert.False(t, list)
+	assert.True(t, ok)
+
+	name, list, ok = PatternVariable(call.Args[1])
+	assert.Equal(t, "args", name)
+	assert.True(t, list)
+	assert.True(t, ok)
+
+	_, _, ok = PatternVariable(call.Fun)
+	assert.False(t, ok)
+}
@@ -28,6 +28,7 @@ type SimpleSelector struct {
 
 	Combinator string                  `parser:"( @('>' | '+' | '~')?"`
 	Name       string                  `parser:"  @(Ident | '*')?"`
+	Field      string                  `parser:"  ( '@' @Ident )?"`
 	Options    []*SimpleSelectorOption `parser:"  @@* )!"`
 }
 
@@ -37,66 +38,140 @@ type SimpleSelectorOption struct {
 
 	Attribute *Attribute `parser:"'[' @@ ']'"`
 	Pseudo    *Pseudo    `parser:"| ':' @@"`
+	// Pattern is not parsed from query but set by ParsePattern
+	Pattern *Pattern
 }
 
 // Attribute represents the attribute option for SimpleSelector
 type Attribute struct {
 	Pos lexer.Position
 
-	Name     string `parser:"@Ident"`
-	Operator string `parser:"@('=' | ('~' '=') | ('|' '=') | ('^' '=') | ('$' '=') | ('*' '='))?"`
-	Value    string `parser:"@(String | String2)?"`
+	Name     string  `parser:"@Ident ( @'.' @(Ident | Number) )*"`
+	Operator string  `parser:"@(('=' '~'?) | ('!' '~') | ('~' '=') | ('|' '=') | ('^' '=') | ('$' '=') | ('*' '='))?"`
+	Value    string  `parser:"( @(String | String2)"`
+	Regexp   *Regexp `parser:"| @Regexp"`
+	Variable string  `parser:"| @Variable )?"`
+	Modifier string  `parser:"@(\"i\" | \"s\")?"`
+	// Path is the field names of Name split by '.', set by Parse
+	Path []string
 }
 
 // Pseudo represents the pseudo option for SimpleSelector
 type Pseudo struct {
 	Pos lexer.Position
 
-	Empty       *PseudoEmpty       `parser:"@@"`
-	FirstChild  *PseudoFirstChild  `parser:"| @@"`
-	FirstOfType *PseudoFirstOfType `parser:"| @@"`
-	Has         *PseudoHas         `parser:"| @@"`
-	Is          *PseudoIs          `parser:"| @@"`
-	LastChild   *PseudoLastChild   `parser:"| @@"`
-	LastOfType  *PseudoLastOfType  `parser:"| @@"`
-	Not         *PseudoNot         `parser:"| @@"`
-	Root        *PseudoRoot        `parser:"| @@"`
+	AssignableTo  *PseudoAssignableTo  `parser:"@@"`
+	Empty         *PseudoEmpty         `parser:"| @@"`
+	FirstChild    *PseudoFirstChild    `parser:"| @@"`
+	FirstOfType   *PseudoFirstOfType   `parser:"| @@"`
+	Has           *PseudoHas           `parser:"| @@"`
+	Implements    *PseudoImplements    `parser:"| @@"`
+	Is            *PseudoIs            `parser:"| @@"`
+	LastChild     *PseudoLastChild     `parser:"| @@"`
+	LastOfType    *PseudoLastOfType    `parser:"| @@"`
+	Not           *PseudoNot           `parser:"| @@"`
+	NthChild      *PseudoNthChild      `parser:"| @@"`
+	NthLastChild  *PseudoNthLastChild  `parser:"| @@"`
+	NthLastOfType *PseudoNthLastOfType `parser:"| @@"`
+	NthOfType     *PseudoNthOfType     `parser:"| @@"`
+	Object        *PseudoObject        `parser:"| @@"`
+	OnlyChild     *PseudoOnlyChild     `parser:"| @@"`
+	OnlyOfType    *PseudoOnlyOfType    `parser:"| @@"`
+	Root          *PseudoRoot          `parser:"| @@"`
+	Scope         *PseudoScope         `parser:"| @@"`
+	Type          *PseudoType          `parser:"| @@"`
+	Where         *PseudoWhere         `parser:"| @@"`
+}
+
+// selectors returns the selectors passed to pseudo like `:has(Query)`
+func (p *Pseudo) selectors() []*Selector {
+	switch {
+	case p.Has != nil:
+		return p.Has.Selectors
+	case p.Is != nil:
+		return p.Is.Selectors
+	case p.Not != nil:
+		return p.Not.Selectors
+	case p.NthChild != nil:
+		return p.NthChild.Selectors
+	case p.NthLastChild != nil:
+		return p.NthLastChild.Selectors
+	case p.Where != nil:
+		return p.Where.Selectors
+	}
+	return nil
+}
+
+// HasVariables returns true if selector has metavariables or patterns, including selectors in pseudo classes
+func (s *Selector) HasVariables() bool {
+	for _, ss := range s.SimpleSelectors {
+		for _, opt := range ss.Options {
+			if opt.Pattern != nil || opt.Attribute != nil && opt.Attribute.Variable != "" {
+				return true
+			}
+			if opt.Pseudo == nil {
+				continue
+			}
+			for _, selector := range opt.Pseudo.selectors() {
+				if selector.HasVariables() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// PseudoAssignableTo represents the assignable-to pseudo
+type PseudoAssignableTo struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"assignable-to\""`
+	Type string `parser:"'(' @(String | String2) ')'"`
 }
 
 // PseudoEmpty represents the empty pseudo
 type PseudoEmpty struct {
 	Pos lexer.Position
 
-	Name string `parser:"'empty'"`
+	Name string `parser:"\"empty\""`
 }
 
 // PseudoFirstChild represents the first-child pseudo
 type PseudoFirstChild struct {
 	Pos lexer.Position
 
-	Name string `parser:"'first-child'"`
+	Name string `parser:"\"first-child\""`
 }
 
 // PseudoFirstOfType represents the first-of-type pseudo
 type PseudoFirstOfType struct {
 	Pos lexer.Position
 
-	Name string `parser:"'first-of-type'"`
+	Name string `parser:"\"first-of-type\""`
 }
 
 // PseudoHas represents the has pseudo
 type PseudoHas struct {
 	Pos lexer.Position
 
-	Name      string      `parser:"'has'"`
+	Name      string      `parser:"\"has\""`
 	Selectors []*Selector `parser:"'(' @@ ( ',' @@ )* ')'"`
 }
 
+// PseudoImplements represents the implements pseudo
+type PseudoImplements struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"implements\""`
+	Type string `parser:"'(' @(String | String2) ')'"`
+}
+
 // PseudoIs represents the is pseudo
 type PseudoIs struct {
 	Pos lexer.Position
 
-	Name      string      `parser:"'is'"`
+	Name      string      `parser:"\"is\""`
 	Selectors []*Selector `parser:"'(' @@ ( ',' @@ )* ')'"`
 }
 
@@ -104,29 +179,108 @@ type PseudoIs struct {
 type PseudoLastChild struct {
 	Pos lexer.Position
 
-	Name string `parser:"'last-child'"`
+	Name string `parser:"\"last-child\""`
 }
 
 // PseudoLastOfType represents the last-of-type pseudo
 type PseudoLastOfType struct {
 	Pos lexer.Position
 
-	Name string `parser:"'last-of-type'"`
+	Name string `parser:"\"last-of-type\""`
 }
 
 // PseudoNot represents the not pseudo
 type PseudoNot struct {
 	Pos lexer.Position
 
-	Name      string      `parser:"'not'"`
+	Name      string      `parser:"\"not\""`
 	Selectors []*Selector `parser:"'(' @@ ( ',' @@ )* ')'"`
 }
 
+// PseudoNthChild represents the nth-child pseudo
+type PseudoNthChild struct {
+	Pos lexer.Position
+
+	Name      string      `parser:"\"nth-child\""`
+	Nth       *Nth        `parser:"'(' @@"`
+	Selectors []*Selector `parser:"( \"of\" @@ ( ',' @@ )* )? ')'"`
+}
+
+// PseudoNthLastChild represents the nth-last-child pseudo
+type PseudoNthLastChild struct {
+	Pos lexer.Position
+
+	Name      string      `parser:"\"nth-last-child\""`
+	Nth       *Nth        `parser:"'(' @@"`
+	Selectors []*Selector `parser:"( \"of\" @@ ( ',' @@ )* )? ')'"`
+}
+
+// PseudoNthLastOfType represents the nth-last-of-type pseudo
+type PseudoNthLastOfType struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"nth-last-of-type\""`
+	Nth  *Nth   `parser:"'(' @@ ')'"`
+}
+
+// PseudoNthOfType represents the nth-of-type pseudo
+type PseudoNthOfType struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"nth-of-type\""`
+	Nth  *Nth   `parser:"'(' @@ ')'"`
+}
+
+// PseudoObject represents the object pseudo
+type PseudoObject struct {
+	Pos lexer.Position
+
+	Name   string `parser:"\"object\""`
+	Object string `parser:"'(' @(String | String2) ')'"`
+}
+
+// PseudoOnlyChild represents the only-child pseudo
+type PseudoOnlyChild struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"only-child\""`
+}
+
+// PseudoOnlyOfType represents the only-of-type pseudo
+type PseudoOnlyOfType struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"only-of-type\""`
+}
+
 // PseudoRoot represents the root pseudo
 type PseudoRoot struct {
 	Pos lexer.Position
 
-	Name string `parser:"'root'"`
+	Name string `parser:"\"root\""`
+}
+
+// PseudoScope represents the scope pseudo
+type PseudoScope struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"scope\""`
+}
+
+// PseudoType represents the type pseudo
+type PseudoType struct {
+	Pos lexer.Position
+
+	Name string `parser:"\"type\""`
+	Type string `parser:"'(' @(String | String2) ')'"`
+}
+
+// PseudoWhere represents the where pseudo
+type PseudoWhere struct {
+	Pos lexer.Position
+
+	Name      string      `parser:"\"where\""`
+	Selectors []*Selector `parser:"'(' @@ ( ',' @@ )* ')'"`
 }
 
 var (
@@ -134,7 +288,9 @@ var (
 Ident = (alpha | "_") { "_" | "-" |alpha | digit } .
 String = "\"" { "\u0000"…"\uffff"-"\""-"\\" | "\\" any } "\"" .
 String2 = "'" { "\u0000"…"\uffff"-"'"-"\\" | "\\" any } "'" .
+Regexp = "/" { "\u0000"…"\uffff"-"/"-"\\" | "\\" any } "/" { alpha } .
 Number = [ "-" | "+" ] digit { digit } .
+Variable = "$" (alpha | "_") { "_" | alpha | digit } .
 Punct = "!"…"/" | ":"…"@" | "["…` + "\"`\"" + ` | "{"…"~" .
 Whitespace = " " | "\t" | "\n" | "\r" .
 
@@ -152,6 +308,9 @@ func Parse(q string) (*Query, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := validateSelectors(query.Selectors); err != nil {
+		return nil, err
+	}
 	return query, nil
 }
 
@@ -90,6 +90,37 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Package@Name",
+			args{
+				q: "Package@Name",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name:  "Package",
+								Field: "Name",
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
 		{
 			"Package, Package",
 			args{
@@ -329,6 +360,55 @@ func TestParse(t *testing.T) {
 												Offset: 8,
 											},
 											Name: "Name",
+											Path: []string{"Name"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Package[Recv.List.0.Name]",
+			args{
+				q: "Package[Recv.List.0.Name]",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name: "Package",
+								Options: []*SimpleSelectorOption{
+									&SimpleSelectorOption{
+										Pos: lexer.Position{
+											Line:   1,
+											Column: 8,
+											Offset: 7,
+										},
+										Attribute: &Attribute{
+											Pos: lexer.Position{
+												Line:   1,
+												Column: 9,
+												Offset: 8,
+											},
+											Name: "Recv.List.0.Name",
+											Path: []string{"Recv", "List", "0", "Name"},
 										},
 									},
 								},
@@ -378,6 +458,58 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "=",
 											Value:    "foo",
+											Path:     []string{"Name"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Package[Name='foo' i]",
+			args{
+				q: "Package[Name='foo' i]",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name: "Package",
+								Options: []*SimpleSelectorOption{
+									&SimpleSelectorOption{
+										Pos: lexer.Position{
+											Line:   1,
+											Column: 8,
+											Offset: 7,
+										},
+										Attribute: &Attribute{
+											Pos: lexer.Position{
+												Line:   1,
+												Column: 9,
+												Offset: 8,
+											},
+											Name:     "Name",
+											Operator: "=",
+											Value:    "foo",
+											Modifier: "i",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -427,6 +559,7 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "=",
 											Value:    "foo",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -476,6 +609,7 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "~=",
 											Value:    "foo",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -525,6 +659,7 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "~=",
 											Value:    "foo",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -574,6 +709,7 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "|=",
 											Value:    "foo",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -623,6 +759,7 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "^=",
 											Value:    "foo",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -672,6 +809,7 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "$=",
 											Value:    "foo",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -721,6 +859,57 @@ func TestParse(t *testing.T) {
 											Name:     "Name",
 											Operator: "*=",
 											Value:    "foo",
+											Path:     []string{"Name"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Ident[Name=$x]",
+			args{
+				q: "Ident[Name=$x]",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name: "Ident",
+								Options: []*SimpleSelectorOption{
+									&SimpleSelectorOption{
+										Pos: lexer.Position{
+											Line:   1,
+											Column: 6,
+											Offset: 5,
+										},
+										Attribute: &Attribute{
+											Pos: lexer.Position{
+												Line:   1,
+												Column: 7,
+												Offset: 6,
+											},
+											Name:     "Name",
+											Operator: "=",
+											Variable: "$x",
+											Path:     []string{"Name"},
 										},
 									},
 								},
@@ -731,6 +920,54 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Invalid Ident[Name^=$x]",
+			args{
+				q: "Ident[Name^=$x]",
+			},
+			nil,
+			true,
+		},
+		{
+			"Invalid Package[Name=~'foo']",
+			args{
+				q: "Package[Name=~'foo']",
+			},
+			nil,
+			true,
+		},
+		{
+			"Invalid Package[Name=/foo/]",
+			args{
+				q: "Package[Name=/foo/]",
+			},
+			nil,
+			true,
+		},
+		{
+			"Invalid Package[Name=~/foo/x]",
+			args{
+				q: "Package[Name=~/foo/x]",
+			},
+			nil,
+			true,
+		},
+		{
+			"Invalid Package[Name i]",
+			args{
+				q: "Package[Name i]",
+			},
+			nil,
+			true,
+		},
+		{
+			"Invalid Package[Name=~/foo/ i]",
+			args{
+				q: "Package[Name=~/foo/ i]",
+			},
+			nil,
+			true,
+		},
 		{
 			"Package:empty",
 			args{
@@ -1234,6 +1471,157 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Package:nth-child(2n+1 of File)",
+			args{
+				q: "Package:nth-child(2n+1 of File)",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name: "Package",
+								Options: []*SimpleSelectorOption{
+									&SimpleSelectorOption{
+										Pos: lexer.Position{
+											Line:   1,
+											Column: 8,
+											Offset: 7,
+										},
+										Pseudo: &Pseudo{
+											Pos: lexer.Position{
+												Line:   1,
+												Column: 9,
+												Offset: 8,
+											},
+											NthChild: &PseudoNthChild{
+												Pos: lexer.Position{
+													Line:   1,
+													Column: 9,
+													Offset: 8,
+												},
+												Nth: &Nth{
+													Pos: lexer.Position{
+														Line:   1,
+														Column: 19,
+														Offset: 18,
+													},
+													A: 2,
+													B: 1,
+												},
+												Selectors: []*Selector{
+													&Selector{
+														Pos: lexer.Position{
+															Line:   1,
+															Column: 27,
+															Offset: 26,
+														},
+														SimpleSelectors: []*SimpleSelector{
+															&SimpleSelector{
+																Pos: lexer.Position{
+																	Line:   1,
+																	Column: 27,
+																	Offset: 26,
+																},
+																Name: "File",
+															},
+														},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Package:nth-of-type(-n+3)",
+			args{
+				q: "Package:nth-of-type(-n+3)",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name: "Package",
+								Options: []*SimpleSelectorOption{
+									&SimpleSelectorOption{
+										Pos: lexer.Position{
+											Line:   1,
+											Column: 8,
+											Offset: 7,
+										},
+										Pseudo: &Pseudo{
+											Pos: lexer.Position{
+												Line:   1,
+												Column: 9,
+												Offset: 8,
+											},
+											NthOfType: &PseudoNthOfType{
+												Pos: lexer.Position{
+													Line:   1,
+													Column: 9,
+													Offset: 8,
+												},
+												Nth: &Nth{
+													Pos: lexer.Position{
+														Line:   1,
+														Column: 21,
+														Offset: 20,
+													},
+													A: -1,
+													B: 3,
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Invalid Package:nth-child(2x)",
+			args{
+				q: "Package:nth-child(2x)",
+			},
+			nil,
+			true,
+		},
 		{
 			"Package:root",
 			args{
@@ -1287,6 +1675,131 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Package:scope",
+			args{
+				q: "Package:scope",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name: "Package",
+								Options: []*SimpleSelectorOption{
+									&SimpleSelectorOption{
+										Pos: lexer.Position{
+											Line:   1,
+											Column: 8,
+											Offset: 7,
+										},
+										Pseudo: &Pseudo{
+											Pos: lexer.Position{
+												Line:   1,
+												Column: 9,
+												Offset: 8,
+											},
+											Scope: &PseudoScope{
+												Pos: lexer.Position{
+													Line:   1,
+													Column: 9,
+													Offset: 8,
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Package:where(Package)",
+			args{
+				q: "Package:where(Package)",
+			},
+			&Query{
+				lexer.Position{
+					Line:   1,
+					Column: 1,
+				},
+				[]*Selector{
+					&Selector{
+						lexer.Position{
+							Line:   1,
+							Column: 1,
+						},
+						[]*SimpleSelector{
+							&SimpleSelector{
+								Pos: lexer.Position{
+									Line:   1,
+									Column: 1,
+								},
+								Name: "Package",
+								Options: []*SimpleSelectorOption{
+									&SimpleSelectorOption{
+										Pos: lexer.Position{
+											Line:   1,
+											Column: 8,
+											Offset: 7,
+										},
+										Pseudo: &Pseudo{
+											Pos: lexer.Position{
+												Line:   1,
+												Column: 9,
+												Offset: 8,
+											},
+											Where: &PseudoWhere{
+												Pos: lexer.Position{
+													Line:   1,
+													Column: 9,
+													Offset: 8,
+												},
+												Selectors: []*Selector{
+													&Selector{
+														Pos: lexer.Position{
+															Line:   1,
+															Column: 15,
+															Offset: 14,
+														},
+														SimpleSelectors: []*SimpleSelector{
+															&SimpleSelector{
+																Pos: lexer.Position{
+																	Line:   1,
+																	Column: 15,
+																	Offset: 14,
+																},
+																Name: "Package",
+															},
+														},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1299,3 +1812,32 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestSelector_HasVariables(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"* * Ident", false},
+		{"Ident[Name='x']", false},
+		{"Ident[Name=$x]", true},
+		{"CallExpr:has(Ident[Name=$x]) > Ident", true},
+		{"CallExpr:not(:is(Ident[Name=$x]))", true},
+		{"CallExpr:nth-child(1 of Ident[Name=$x])", true},
+		{"CallExpr:has(Ident[Name='x'])", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, MustParse(tt.query).Selectors[0].HasVariables())
+		})
+	}
+	assert.True(t, MustParsePattern("f($x)").Selectors[0].HasVariables())
+}
+
+func TestParse_AttributePath(t *testing.T) {
+	q := MustParse("CallExpr[Fun.Sel.Name='Println']:has(Ident[Name='a'])")
+	options := q.Selectors[0].SimpleSelectors[0].Options
+	assert.Equal(t, []string{"Fun", "Sel", "Name"}, options[0].Attribute.Path)
+	nested := options[1].Pseudo.Has.Selectors[0].SimpleSelectors[0].Options[0]
+	assert.Equal(t, []string{"Name"}, nested.Attribute.Path)
+}
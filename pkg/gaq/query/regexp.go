@@ -0,0 +1,84 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Regexp represents `/pattern/flags` regular expression.
+// Pattern is compiled on parse and cached.
+type Regexp struct {
+	Pattern string
+	Flags   string
+
+	Compiled *regexp.Regexp
+}
+
+// Capture compiles captured `/pattern/flags` token
+func (r *Regexp) Capture(values []string) error {
+	value := strings.Join(values, "")
+	end := strings.LastIndex(value, "/")
+	if !strings.HasPrefix(value, "/") || end <= 0 {
+		return fmt.Errorf("invalid regular expression %s", value)
+	}
+	r.Pattern = strings.Replace(value[1:end], `\/`, "/", -1)
+	r.Flags = value[end+1:]
+	for _, flag := range r.Flags {
+		if !strings.ContainsRune("imsU", flag) {
+			return fmt.Errorf("unknown regular expression flag %c", flag)
+		}
+	}
+	pattern := r.Pattern
+	if r.Flags != "" {
+		pattern = fmt.Sprintf("(?%s)%s", r.Flags, pattern)
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	r.Compiled = compiled
+	return nil
+}
+
+// MatchString reports whether s contains any match of the regular expression
+func (r *Regexp) MatchString(s string) bool {
+	return r.Compiled.MatchString(s)
+}
+
+// validateSelectors checks attribute operator and value combinations and sets field paths of attributes recursively
+func validateSelectors(selectors []*Selector) error {
+	for _, selector := range selectors {
+		for _, ss := range selector.SimpleSelectors {
+			for _, opt := range ss.Options {
+				if err := validateOption(opt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateOption(opt *SimpleSelectorOption) error {
+	if a := opt.Attribute; a != nil {
+		a.Path = strings.Split(a.Name, ".")
+		isRegexpOperator := a.Operator == "=~" || a.Operator == "!~"
+		if isRegexpOperator && a.Regexp == nil {
+			return fmt.Errorf("%s: operator %s expects /regexp/", a.Pos, a.Operator)
+		}
+		if !isRegexpOperator && a.Regexp != nil {
+			return fmt.Errorf("%s: operator %s expects string", a.Pos, a.Operator)
+		}
+		if a.Variable != "" && a.Operator != "=" {
+			return fmt.Errorf("%s: metavariable %s expects operator =", a.Pos, a.Variable)
+		}
+		if a.Modifier != "" && (a.Operator == "" || isRegexpOperator) {
+			return fmt.Errorf("%s: modifier %s expects string value", a.Pos, a.Modifier)
+		}
+	}
+	if p := opt.Pseudo; p != nil {
+		return validateSelectors(p.selectors())
+	}
+	return nil
+}
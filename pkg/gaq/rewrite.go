@@ -0,0 +1,250 @@
+package gaq
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+
+	"github.com/tamayika/gaq/pkg/gaq/query"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Rewriter collects changes of nodes and applies them to ast by astutil.Apply.
+// Nodes are typically the results of QuerySelectorAll or QueryMatches.
+type Rewriter struct {
+	fset     *token.FileSet
+	replaces map[ast.Node]ast.Node
+	wraps    map[ast.Node]ast.Node
+	deletes  map[ast.Node]bool
+	befores  map[ast.Node][]ast.Node
+	afters   map[ast.Node][]ast.Node
+}
+
+// NewRewriter returns Rewriter.
+// fset is used to keep comments attached to nodes when *ast.File is rewritten. If fset is nil, comments are not changed.
+func NewRewriter(fset *token.FileSet) *Rewriter {
+	return &Rewriter{
+		fset:     fset,
+		replaces: map[ast.Node]ast.Node{},
+		wraps:    map[ast.Node]ast.Node{},
+		deletes:  map[ast.Node]bool{},
+		befores:  map[ast.Node][]ast.Node{},
+		afters:   map[ast.Node][]ast.Node{},
+	}
+}
+
+// Replace replaces node by newNode
+func (r *Rewriter) Replace(node ast.Node, newNode ast.Node) {
+	r.replaces[node] = newNode
+}
+
+// Delete deletes node from the list which holds it, like statements or declarations
+func (r *Rewriter) Delete(node ast.Node) {
+	r.deletes[node] = true
+}
+
+// InsertBefore inserts newNode before node in the list which holds it, like statements or declarations
+func (r *Rewriter) InsertBefore(node ast.Node, newNode ast.Node) {
+	r.befores[node] = append(r.befores[node], newNode)
+}
+
+// InsertAfter inserts newNode after node in the list which holds it, like statements or declarations
+func (r *Rewriter) InsertAfter(node ast.Node, newNode ast.Node) {
+	r.afters[node] = append(r.afters[node], newNode)
+}
+
+// Wrap replaces node by go code template which contains node as `$node`, e.g. `must($node)` or `if ok { $node }`
+func (r *Rewriter) Wrap(node ast.Node, tmpl string) error {
+	wrapper, err := query.ParsePatternNode(tmpl)
+	if err != nil {
+		return err
+	}
+	found := false
+	var err2 error
+	ast.Inspect(wrapper, func(n ast.Node) bool {
+		if name, _, ok := query.PatternVariable(n); ok {
+			if name != "node" {
+				err2 = fmt.Errorf("unknown metavariable $%s in template. Only $node is available", name)
+			}
+			found = true
+		}
+		return err2 == nil
+	})
+	if err2 != nil {
+		return err2
+	}
+	if !found {
+		return fmt.Errorf("template must contain $node")
+	}
+	r.wraps[node] = wrapper
+	return nil
+}
+
+// Apply applies changes to root and returns the result.
+// Changes are applied from leaves, so node is wrapped after changes of its descendants are applied.
+// If root is *ast.File, comments of deleted nodes are removed and comments of replaced nodes are moved to new nodes.
+func (r *Rewriter) Apply(root ast.Node) (ast.Node, error) {
+	file, isFile := root.(*ast.File)
+	var cmap ast.CommentMap
+	if isFile && r.fset != nil {
+		cmap = ast.NewCommentMap(r.fset, file, file.Comments)
+	}
+	var err error
+	result := astutil.Apply(root, nil, func(c *astutil.Cursor) bool {
+		node := c.Node()
+		if node == nil || err != nil {
+			return err == nil
+		}
+		inList := c.Index() >= 0
+		if r.deletes[node] {
+			if !inList {
+				err = fmt.Errorf("cannot delete %s because it is not in list", nodeType(node))
+				return false
+			}
+			c.Delete()
+			return true
+		}
+		for _, before := range r.befores[node] {
+			if !inList {
+				err = fmt.Errorf("cannot insert before %s because it is not in list", nodeType(node))
+				return false
+			}
+			c.InsertBefore(before)
+		}
+		for i := len(r.afters[node]) - 1; i >= 0; i-- {
+			if !inList {
+				err = fmt.Errorf("cannot insert after %s because it is not in list", nodeType(node))
+				return false
+			}
+			c.InsertAfter(r.afters[node][i])
+		}
+		newNode, ok := r.replaces[node]
+		if wrapper, wrapped := r.wraps[node]; wrapped {
+			newNode, err = substituteNode(wrapper, node)
+			if err != nil {
+				return false
+			}
+			ok = true
+		}
+		if ok {
+			if !canReplace(c, newNode) {
+				err = fmt.Errorf("cannot replace %s in %s by %s", nodeType(node), c.Name(), nodeType(newNode))
+				return false
+			}
+			c.Replace(newNode)
+			if cmap != nil {
+				if comments, ok := cmap[node]; ok {
+					cmap[newNode] = append(cmap[newNode], comments...)
+					delete(cmap, node)
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cmap != nil {
+		file.Comments = cmap.Filter(file).Comments()
+	}
+	return result, nil
+}
+
+// canReplace checks whether newNode can be set to the field of parent which holds current node
+func canReplace(c *astutil.Cursor, newNode ast.Node) bool {
+	field := reflect.Indirect(reflect.ValueOf(c.Parent())).FieldByName(c.Name())
+	if !field.IsValid() {
+		// root node
+		return true
+	}
+	t := field.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return reflect.TypeOf(newNode).AssignableTo(t)
+}
+
+// substituteNode returns copy of wrapper whose `$node` is replaced by node.
+// `$node` as statement is replaced by node if node is statement.
+func substituteNode(wrapper ast.Node, node ast.Node) (ast.Node, error) {
+	wrapper = copyNode(wrapper, node.Pos())
+	var err error
+	result := astutil.Apply(wrapper, func(c *astutil.Cursor) bool {
+		if _, _, ok := query.PatternVariable(c.Node()); !ok {
+			return true
+		}
+		var replaced ast.Node
+		switch c.Node().(type) {
+		case *ast.ExprStmt:
+			if _, ok := node.(ast.Stmt); !ok {
+				// substitute expression in X
+				return true
+			}
+			replaced = node
+		case *ast.Field:
+			// substitute type of unnamed field
+			return true
+		default:
+			replaced = node
+		}
+		if !canReplace(c, replaced) {
+			err = fmt.Errorf("cannot wrap %s by template", nodeType(node))
+			return false
+		}
+		c.Replace(replaced)
+		return false
+	}, nil)
+	return result, err
+}
+
+// copyNode deep copies pointers of node so that template can be used for multiple nodes.
+// Positions are set to pos so that comments around the wrapped node are kept outside.
+func copyNode(node ast.Node, pos token.Pos) ast.Node {
+	return copyValue(reflect.ValueOf(node), reflect.ValueOf(pos)).Interface().(ast.Node)
+}
+
+func copyValue(v reflect.Value, pos reflect.Value) reflect.Value {
+	if v.Type() == posType {
+		if v.Interface().(token.Pos).IsValid() {
+			return pos
+		}
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		switch v.Type() {
+		case objectType, scopeType:
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem(), pos))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem(), pos))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			c.Field(i).Set(copyValue(v.Field(i), pos))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), pos))
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,222 @@
+package gaq
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestRewriter_Apply(t *testing.T) {
+	source := `package foo
+
+func f() error {
+	// setup
+	a := g()
+	// debug
+	log.Print(a)
+	return h(a)
+}
+`
+	tests := []struct {
+		name    string
+		query   string
+		rewrite func(r *Rewriter, n ast.Node) error
+		want    string
+		wantErr bool
+	}{
+		{
+			"Replace",
+			"CallExpr > Ident[Name='h']",
+			func(r *Rewriter, n ast.Node) error {
+				r.Replace(n, ast.NewIdent("k"))
+				return nil
+			},
+			`package foo
+
+func f() error {
+	// setup
+	a := g()
+	// debug
+	log.Print(a)
+	return k(a)
+}
+`,
+			false,
+		},
+		{
+			"Delete removes comments",
+			"ExprStmt:has(Ident[Name='Print'])",
+			func(r *Rewriter, n ast.Node) error {
+				r.Delete(n)
+				return nil
+			},
+			`package foo
+
+func f() error {
+	// setup
+	a := g()
+
+	return h(a)
+}
+`,
+			false,
+		},
+		{
+			"Insert",
+			"ReturnStmt",
+			func(r *Rewriter, n ast.Node) error {
+				r.InsertBefore(n, &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("before1")}})
+				r.InsertBefore(n, &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("before2")}})
+				r.InsertAfter(n, &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("after1")}})
+				r.InsertAfter(n, &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("after2")}})
+				return nil
+			},
+			`package foo
+
+func f() error {
+	// setup
+	a := g()
+	// debug
+	log.Print(a)
+	before1()
+	before2()
+	return h(a)
+	after1()
+	after2()
+}
+`,
+			false,
+		},
+		{
+			"Wrap expression",
+			"CallExpr:has(> Ident[Name=~/^[gh]$/])",
+			func(r *Rewriter, n ast.Node) error {
+				return r.Wrap(n, "must($node)")
+			},
+			`package foo
+
+func f() error {
+	// setup
+	a := must(g())
+	// debug
+	log.Print(a)
+	return must(h(a))
+}
+`,
+			false,
+		},
+		{
+			"Wrap statement keeps comments",
+			"ExprStmt",
+			func(r *Rewriter, n ast.Node) error {
+				return r.Wrap(n, "if debug { $node }")
+			},
+			`package foo
+
+func f() error {
+	// setup
+	a := g()
+	// debug
+	if debug {
+		log.Print(a)
+	}
+	return h(a)
+}
+`,
+			false,
+		},
+		{
+			"Wrap nested nodes",
+			"CallExpr",
+			func(r *Rewriter, n ast.Node) error {
+				return r.Wrap(n, "must($node)")
+			},
+			`package foo
+
+func f() error {
+	// setup
+	a := must(g())
+	// debug
+	must(log.Print(a))
+	return must(h(a))
+}
+`,
+			false,
+		},
+		{
+			"Wrap with unknown metavariable",
+			"ReturnStmt",
+			func(r *Rewriter, n ast.Node) error {
+				return r.Wrap(n, "must($x)")
+			},
+			"",
+			true,
+		},
+		{
+			"Wrap statement by expression",
+			"ReturnStmt",
+			func(r *Rewriter, n ast.Node) error {
+				return r.Wrap(n, "must($node)")
+			},
+			"",
+			true,
+		},
+		{
+			"Replace by invalid type",
+			"FuncDecl > Ident",
+			func(r *Rewriter, n ast.Node) error {
+				r.Replace(n, &ast.CallExpr{Fun: ast.NewIdent("k")})
+				return nil
+			},
+			"",
+			true,
+		},
+		{
+			"Delete not in list",
+			"CallExpr > Ident[Name='h']",
+			func(r *Rewriter, n ast.Node) error {
+				r.Delete(n)
+				return nil
+			},
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, "", source, parser.ParseComments)
+			if !assert.NoError(t, err) {
+				return
+			}
+			r := NewRewriter(fset)
+			var rewriteErr error
+			for _, n := range MustParseNode(f).QuerySelectorAll(query.MustParse(tt.query)) {
+				if err := tt.rewrite(r, n); err != nil {
+					rewriteErr = err
+				}
+			}
+			if rewriteErr == nil {
+				_, rewriteErr = r.Apply(f)
+			}
+			if tt.wantErr {
+				assert.Error(t, rewriteErr)
+				return
+			}
+			if !assert.NoError(t, rewriteErr) {
+				return
+			}
+			var buf bytes.Buffer
+			if !assert.NoError(t, format.Node(&buf, fset, f)) {
+				return
+			}
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
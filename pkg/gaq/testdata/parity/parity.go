@@ -0,0 +1,49 @@
+package parity
+
+type counter struct {
+	name  string
+	count int
+}
+
+func (c *counter) add(n int) *counter {
+	c.count += n
+	return c
+}
+
+func (c *counter) merge(o *counter) {
+	c.count += o.count
+}
+
+func (c *counter) label() string {
+	return c.name
+}
+
+func (c *counter) reset() int {
+	old := c.count
+	c.count = 0
+	return old
+}
+
+func sum(a, b int) int {
+	use(b)
+	use(a)
+	return a + b
+}
+
+func run(c *counter, n int) {
+	c.add(c.count)
+	c.merge(c)
+	n = next(n)
+	total := sum(n, n)
+	total = next(sum(total, n))
+	max(n, total, n)
+	if n > 0 {
+		c = c.add(n)
+	}
+}
+
+func use(v int) {}
+
+func next(v int) int {
+	return v + 1
+}
@@ -0,0 +1,27 @@
+package typed
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+type Server struct{}
+
+func (s *Server) Read(p []byte) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func read(r io.Reader) error {
+	_, err := r.Read(nil)
+	return err
+}
+
+func run() error {
+	reader := strings.NewReader("gaq")
+	server := &Server{}
+	server.Read(nil)
+	count := 1
+	_ = count
+	return read(reader)
+}
@@ -0,0 +1,215 @@
+package gaq
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Package represents type checked package
+type Package struct {
+	Path      string
+	Fset      *token.FileSet
+	Types     *types.Package
+	TypesInfo *types.Info
+	Filenames []string
+	Files     []*Node
+}
+
+// LoadPackages loads and type checks packages matched by patterns in dir.
+// If fset is nil, new token.FileSet is used.
+func LoadPackages(fset *token.FileSet, dir string, patterns ...string) ([]*Package, error) {
+	if fset == nil {
+		fset = token.NewFileSet()
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports |
+			packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Dir:  dir,
+		Fset: fset,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*Package{}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, pkg.Errors[0]
+		}
+		p := &Package{
+			Path:      pkg.PkgPath,
+			Fset:      fset,
+			Types:     pkg.Types,
+			TypesInfo: pkg.TypesInfo,
+			Filenames: pkg.CompiledGoFiles,
+		}
+		for _, f := range pkg.Syntax {
+			node, err := ParseNodeWithTypes(f, pkg.Types, pkg.TypesInfo)
+			if err != nil {
+				return nil, err
+			}
+			p.Files = append(p.Files, node)
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// ParseNodeWithTypes parses ast.Node and returns *Node with type information
+func ParseNodeWithTypes(n ast.Node, pkg *types.Package, info *types.Info) (*Node, error) {
+	w := &walker{types: pkg, typesInfo: info}
+	ast.Walk(w, n)
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.node, nil
+}
+
+// TypeOf returns the type of node if type information exists
+func (n *Node) TypeOf() types.Type {
+	if n.TypesInfo == nil {
+		return nil
+	}
+	expr, ok := n.Node.(ast.Expr)
+	if !ok {
+		return nil
+	}
+	return n.TypesInfo.TypeOf(expr)
+}
+
+// ObjectOf returns the object denoted by node if type information exists.
+// For SelectorExpr, the object of selector is returned. For CallExpr, the object of called function is returned.
+func (n *Node) ObjectOf() types.Object {
+	if n.TypesInfo == nil {
+		return nil
+	}
+	return objectOf(n.TypesInfo, n.Node)
+}
+
+func objectOf(info *types.Info, n ast.Node) types.Object {
+	switch n := n.(type) {
+	case *ast.Ident:
+		return info.ObjectOf(n)
+	case *ast.SelectorExpr:
+		return info.ObjectOf(n.Sel)
+	case *ast.CallExpr:
+		return objectOf(info, ast.Unparen(n.Fun))
+	case *ast.ParenExpr:
+		return objectOf(info, ast.Unparen(n))
+	}
+	return nil
+}
+
+func (n *Node) isMatchType(expected string) bool {
+	t := n.TypeOf()
+	if t == nil {
+		return false
+	}
+	for _, qualifier := range []types.Qualifier{nil, qualifyByName, types.RelativeTo(n.Types)} {
+		if types.TypeString(t, qualifier) == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func qualifyByName(pkg *types.Package) string {
+	return pkg.Name()
+}
+
+func (n *Node) isMatchImplements(expected string) bool {
+	t := n.TypeOf()
+	if t == nil {
+		return false
+	}
+	target := n.lookupType(expected)
+	if target == nil {
+		return false
+	}
+	iface, ok := target.Underlying().(*types.Interface)
+	if !ok {
+		return false
+	}
+	return types.Implements(t, iface)
+}
+
+func (n *Node) isMatchAssignableTo(expected string) bool {
+	t := n.TypeOf()
+	if t == nil {
+		return false
+	}
+	target := n.lookupType(expected)
+	if target == nil {
+		return false
+	}
+	return types.AssignableTo(t, target)
+}
+
+func (n *Node) isMatchObject(expected string) bool {
+	obj := n.ObjectOf()
+	if obj == nil {
+		return false
+	}
+	return objectName(obj) == expected
+}
+
+// objectName returns `(*path.Type).Method` for methods, `path.Name` for package level objects
+func objectName(obj types.Object) string {
+	if fn, ok := obj.(*types.Func); ok {
+		return fn.FullName()
+	}
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	return fmt.Sprintf("%s.%s", obj.Pkg().Path(), obj.Name())
+}
+
+// lookupType resolves type name like `error`, `io.Reader` or `*net/http.Client`.
+// Packages are searched from imports of the package of node.
+func (n *Node) lookupType(name string) types.Type {
+	if strings.HasPrefix(name, "*") {
+		t := n.lookupType(name[1:])
+		if t == nil {
+			return nil
+		}
+		return types.NewPointer(t)
+	}
+	scope := types.Universe
+	i := strings.LastIndex(name, ".")
+	if i >= 0 {
+		pkg := findPackage(n.Types, name[:i], map[*types.Package]bool{})
+		if pkg == nil {
+			return nil
+		}
+		scope = pkg.Scope()
+		name = name[i+1:]
+	} else if n.Types != nil && n.Types.Scope().Lookup(name) != nil {
+		scope = n.Types.Scope()
+	}
+	typeName, ok := scope.Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	return typeName.Type()
+}
+
+func findPackage(pkg *types.Package, path string, visited map[*types.Package]bool) *types.Package {
+	if pkg == nil || visited[pkg] {
+		return nil
+	}
+	visited[pkg] = true
+	if pkg.Path() == path {
+		return pkg
+	}
+	for _, imported := range pkg.Imports() {
+		if found := findPackage(imported, path, visited); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package gaq
+
+import (
+	"go/ast"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestLoadPackages(t *testing.T) {
+	pkgs, err := LoadPackages(nil, "testdata/typed", ".")
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, pkgs, 1) {
+		return
+	}
+	pkg := pkgs[0]
+	assert.Equal(t, "example.com/typed", pkg.Path)
+	assert.Len(t, pkg.Files, 1)
+	assert.NotNil(t, pkg.Files[0].TypesInfo)
+}
+
+func TestNode_QuerySelectorAll_Types(t *testing.T) {
+	pkgs, err := LoadPackages(nil, "testdata/typed", ".")
+	if !assert.NoError(t, err) {
+		return
+	}
+	n := pkgs[0].Files[0]
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"AssignStmt > Ident:type('error')", []string{"err"}},
+		{"AssignStmt > Ident:type('*typed.Server')", []string{"server"}},
+		{"AssignStmt > Ident:type('*example.com/typed.Server')", []string{"server"}},
+		{"AssignStmt > Ident:implements('io.Reader')", []string{"reader", "server"}},
+		{"AssignStmt > Ident@Rhs:assignable-to('int')", []string{"count"}},
+		{"CallExpr:object('strings.NewReader') > SelectorExpr > @Sel", []string{"NewReader"}},
+		{"CallExpr:object('(*example.com/typed.Server).Read') > SelectorExpr > @X", []string{"server"}},
+		{"Ident:object('example.com/typed.read')", []string{"read", "read"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			got := []string{}
+			for _, node := range n.QuerySelectorAll(query.MustParse(tt.q)) {
+				got = append(got, node.(*ast.Ident).Name)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	t.Run("Not matched type of package which is not imported", func(t *testing.T) {
+		assert.Empty(t, n.QuerySelectorAll(query.MustParse("Ident:implements('net/http.Handler')")))
+	})
+}
+
+func TestNode_QuerySelectorAll_TypesWithoutInfo(t *testing.T) {
+	n := MustParse(`package main
+	var err error
+	`)
+	assert.Empty(t, n.QuerySelectorAll(query.MustParse("Ident:type('error')")))
+}
@@ -0,0 +1,106 @@
+package gaq
+
+import (
+	"context"
+
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+// Walk calls fn for node and its descendants matched with query in document order.
+// Nodes are matched one by one while walking, so walking stops without visiting the rest when fn returns false.
+// Metavariables are bound from left to right like SelectAll, so the matched nodes are the same as SelectAll
+// except that combinators are matched only in node and its descendants.
+// If ctx is done, walking stops and ctx.Err() is returned.
+func (n *Node) Walk(ctx context.Context, q *query.Query, fn func(n *Node) bool) error {
+	_, err := n.walk(ctx, n, q, fn)
+	return err
+}
+
+func (n *Node) walk(ctx context.Context, limit *Node, q *query.Query, fn func(n *Node) bool) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+	if n.isMatchAnySelectorFromLeft(newMatchContext(limit), q.Selectors, limit) {
+		if !fn(n) {
+			return false, nil
+		}
+	}
+	for _, child := range n.Children {
+		continues, err := child.walk(ctx, limit, q, fn)
+		if !continues || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isMatchAnySelectorFromLeft checks whether node is matched by the last compound of one of selectors.
+// Combinators are matched only in limit and its descendants.
+func (n *Node) isMatchAnySelectorFromLeft(c *matchContext, selectors []*query.Selector, limit *Node) bool {
+	for _, selector := range selectors {
+		chain := make([]*Node, len(selector.SimpleSelectors))
+		if n.findChain(c, selector, len(selector.SimpleSelectors)-1, chain, limit) {
+			return true
+		}
+	}
+	return false
+}
+
+// findChain finds nodes of compounds from right to left by names, fields and combinators,
+// then matches options of the found nodes from left to right.
+// So metavariables bound by the left compounds, including the first found descendant of `:has`, are compared by the right ones as apply does.
+func (n *Node) findChain(c *matchContext, s *query.Selector, selectorIndex int, chain []*Node, limit *Node) bool {
+	ss := s.SimpleSelectors[selectorIndex]
+	if !n.isMatchNameAndField(ss) {
+		return false
+	}
+	chain[selectorIndex] = n
+	if selectorIndex == 0 {
+		return matchChain(c, s, chain)
+	}
+	if n == limit {
+		return false
+	}
+	switch ss.Combinator {
+	case "":
+		for parent := n.Parent; parent != nil; parent = parent.Parent {
+			if parent.findChain(c, s, selectorIndex-1, chain, limit) {
+				return true
+			}
+			if parent == limit {
+				break
+			}
+		}
+	case ">":
+		if n.Parent != nil {
+			return n.Parent.findChain(c, s, selectorIndex-1, chain, limit)
+		}
+	case "+":
+		if n.Parent != nil && n.Index > 0 {
+			return n.Parent.Children[n.Index-1].findChain(c, s, selectorIndex-1, chain, limit)
+		}
+	case "~":
+		if n.Parent != nil && n.Index > 0 {
+			for _, sibling := range n.Parent.Children[:n.Index] {
+				if sibling.findChain(c, s, selectorIndex-1, chain, limit) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchChain matches options of nodes from left to right. Metavariables are undone.
+func matchChain(c *matchContext, s *query.Selector, chain []*Node) bool {
+	mark := c.mark()
+	defer c.rollback(mark)
+	for i, node := range chain {
+		if !node.isMatchOptions(c, s.SimpleSelectors[i]) {
+			return false
+		}
+	}
+	return true
+}
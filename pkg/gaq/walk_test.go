@@ -0,0 +1,127 @@
+package gaq
+
+import (
+	"context"
+	"go/ast"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestNode_Walk(t *testing.T) {
+	n := MustParse(`package foo
+	func f(a, b int) {
+		if a == b {
+			b := a
+		}
+		if a == a {
+			g(a, b)
+		}
+		go func() {
+			h(b)
+		}()
+	}
+	`)
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"Descendant", "FuncDecl Ident"},
+		{"Child", "CallExpr > Ident"},
+		{"Adjacent sibling", "Ident + Ident"},
+		{"General sibling", "IfStmt ~ *"},
+		{"Field", "CallExpr > *@Args"},
+		{"Has", "BlockStmt:has(> ExprStmt)"},
+		{"Metavariable", "BinaryExpr > Ident[Name=$x] + Ident[Name=$x]"},
+		{"Goroutine", "GoStmt FuncLit CallExpr"},
+		{"Root", "File:root > *"},
+		{"Has with back-reference", "CallExpr:has(Ident[Name=$x]) > Ident@Args[Name=$x]"},
+		{"Has with descendant back-reference", "BlockStmt:has(Ident[Name=$x]) CallExpr > Ident[Name=$x]"},
+		{"Has with sibling back-reference", "IfStmt:has(BinaryExpr > Ident[Name=$x]) ~ * Ident[Name=$x]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := query.MustParse(tt.query)
+			got := []*Node{}
+			err := n.Walk(context.Background(), q, func(n *Node) bool {
+				got = append(got, n)
+				return true
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, n.SelectAll(q), got)
+		})
+	}
+}
+
+func TestNode_Walk_Source(t *testing.T) {
+	source, err := ioutil.ReadFile("testdata/parity/parity.go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	n := MustParse(string(source))
+	queries := []string{
+		"CallExpr:has(Ident[Name=$x]) > Ident@Args[Name=$x]",
+		"FuncDecl:has(> FieldList Ident[Name=$x]) ReturnStmt Ident[Name=$x]",
+		"AssignStmt > Ident@Lhs[Name=$x] ~ CallExpr Ident[Name=$x]",
+		"FuncDecl:has(Ident@Names[Name=$x]) CallExpr > Ident@Args[Name=$x]",
+	}
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			parsed := query.MustParse(q)
+			got := []*Node{}
+			err := n.Walk(context.Background(), parsed, func(n *Node) bool {
+				got = append(got, n)
+				return true
+			})
+			assert.NoError(t, err)
+			assert.NotEmpty(t, got)
+			assert.Equal(t, n.SelectAll(parsed), got)
+		})
+	}
+}
+
+func TestNode_Walk_Scope(t *testing.T) {
+	n := MustParse(`package foo
+	func f() {
+		g(h(a))
+	}
+	`)
+	callExpr := n.Select(query.MustParse("CallExpr"))
+	if !assert.NotNil(t, callExpr) {
+		return
+	}
+	names := []string{}
+	err := callExpr.Walk(context.Background(), query.MustParse("FuncDecl Ident, :scope > Ident"), func(n *Node) bool {
+		names = append(names, n.Node.(*ast.Ident).Name)
+		return true
+	})
+	assert.NoError(t, err)
+	// FuncDecl is not in callExpr
+	assert.Equal(t, []string{"g"}, names)
+}
+
+func TestNode_Walk_Stop(t *testing.T) {
+	n := MustParse(`package foo
+	var a, b, c int
+	`)
+	q := query.MustParse("ValueSpec > Ident")
+	names := []string{}
+	err := n.Walk(context.Background(), q, func(n *Node) bool {
+		names = append(names, n.Node.(*ast.Ident).Name)
+		return len(names) < 2
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	names = []string{}
+	err = n.Walk(ctx, q, func(n *Node) bool {
+		names = append(names, n.Node.(*ast.Ident).Name)
+		cancel()
+		return true
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"a"}, names)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tamayika/gaq/pkg/gaq"
+)
+
+// templateData represents the matched node passed to replace template
+type templateData struct {
+	// Text is the source text of node
+	Text string
+	// Type is the node type like `ast.CallExpr`
+	Type string
+	// Field is the field name of parent which holds node
+	Field string
+	// File is the file name
+	File string
+	// Fields are the source texts of child nodes and values of other fields by field name.
+	// Slice of nodes is converted to slice of source texts.
+	Fields map[string]interface{}
+	// Vars are the values of captured metavariables
+	Vars map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	"title": titleCase,
+	"snake": snakeCase,
+	"quote": strconv.Quote,
+	"join":  strings.Join,
+}
+
+var posType = reflect.TypeOf(token.NoPos)
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("replace").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+func newTemplateData(f *sourceFile, fset *token.FileSet, m *gaq.Match, nodeText []byte) *templateData {
+	nodeSource := func(node ast.Node) string {
+		return string(f.source[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset])
+	}
+	fields := map[string]interface{}{}
+	v := reflect.ValueOf(m.Node.Node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := v.Type().Field(i).Name
+		if field.Type() == posType {
+			continue
+		}
+		switch value := field.Interface().(type) {
+		case ast.Node:
+			if !field.IsNil() {
+				fields[name] = nodeSource(value)
+			}
+			continue
+		case token.Token:
+			fields[name] = value.String()
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Slice:
+			texts := []string{}
+			for j := 0; j < field.Len(); j++ {
+				if node, ok := field.Index(j).Interface().(ast.Node); ok {
+					texts = append(texts, nodeSource(node))
+				}
+			}
+			fields[name] = texts
+		case reflect.String, reflect.Bool, reflect.Int:
+			fields[name] = field.Interface()
+		}
+	}
+	vars := captureValues(m)
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	return &templateData{
+		Text:   string(nodeText),
+		Type:   m.Node.Type,
+		Field:  m.Node.Field,
+		File:   f.name,
+		Fields: fields,
+		Vars:   vars,
+	}
+}
+
+// replaceByTemplate replaces matched node in file by the result of template
+func replaceByTemplate(f *sourceFile, fset *token.FileSet, tmpl *template.Template) replaceFunc {
+	return func(m *gaq.Match, nodeText []byte) []byte {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, newTemplateData(f, fset, m, nodeText)); err != nil {
+			log.Fatalf("Template failed.\nerr: %v\nnodeText: %s", err, string(nodeText))
+		}
+		return buf.Bytes()
+	}
+}
+
+// titleCase converts the first letter to upper case, e.g. `fooBar` to `FooBar`
+func titleCase(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// snakeCase converts camel case to snake case, e.g. `FooBar` and `HTTPServer` to `foo_bar` and `http_server`
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prev != '_' && (unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextIsLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tamayika/gaq/pkg/gaq/query"
+)
+
+func TestTitleCase(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"fooBar", "FooBar"},
+		{"FooBar", "FooBar"},
+		{"f", "F"},
+		{"_foo", "_foo"},
+		{"über", "Über"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.want, titleCase(tt.s))
+		})
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"foo", "foo"},
+		{"FooBar", "foo_bar"},
+		{"fooBar", "foo_bar"},
+		{"HTTPServer", "http_server"},
+		{"ServeHTTP", "serve_http"},
+		{"userID", "user_id"},
+		{"Base64Encode", "base64_encode"},
+		{"foo_Bar", "foo_bar"},
+		{"ID", "id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.want, snakeCase(tt.s))
+		})
+	}
+}
+
+func TestNewTemplateData(t *testing.T) {
+	source := "package a\n\nfunc f() {\n\tg(a, b...)\n\t_ = a + b\n}\n"
+	tests := []struct {
+		query string
+		want  *templateData
+	}{
+		{
+			"CallExpr",
+			&templateData{
+				Text:  "g(a, b...)",
+				Type:  "ast.CallExpr",
+				Field: "X",
+				File:  "a.go",
+				Fields: map[string]interface{}{
+					"Fun":  "g",
+					"Args": []string{"a", "b"},
+				},
+				Vars: map[string]string{},
+			},
+		},
+		{
+			"BinaryExpr",
+			&templateData{
+				Text:  "a + b",
+				Type:  "ast.BinaryExpr",
+				Field: "Rhs",
+				File:  "a.go",
+				Fields: map[string]interface{}{
+					"X":  "a",
+					"Op": "+",
+					"Y":  "b",
+				},
+				Vars: map[string]string{},
+			},
+		},
+		{
+			"CallExpr > Ident@Fun[Name=$fn]",
+			&templateData{
+				Text:  "g",
+				Type:  "ast.Ident",
+				Field: "Fun",
+				File:  "a.go",
+				Fields: map[string]interface{}{
+					"Name": "g",
+				},
+				Vars: map[string]string{"fn": "g"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			fset := token.NewFileSet()
+			f, err := parseSourceFile(fset, "a.go", []byte(source))
+			if !assert.NoError(t, err) {
+				return
+			}
+			matches := f.root().QueryMatches(query.MustParse(tt.query))
+			if !assert.NotEmpty(t, matches) {
+				return
+			}
+			m := matches[0]
+			nodeText := f.source[fset.Position(m.Node.Node.Pos()).Offset:fset.Position(m.Node.Node.End()).Offset]
+			assert.Equal(t, tt.want, newTemplateData(f, fset, m, nodeText))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeSourceFile writes replaced source back to file. File is not touched if source is not changed.
+func writeSourceFile(f *sourceFile, replaced []byte) error {
+	if bytes.Equal(f.source, replaced) {
+		return nil
+	}
+	return writeFileAtomic(f.name, replaced)
+}
+
+// writeFileAtomic writes data to temporary file in the same directory and renames it to path.
+// Permission of the original file is kept.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".gaq")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSourceFile(t *testing.T) {
+	source := []byte("package a\n\nfunc f() {}\n")
+	tests := []struct {
+		name     string
+		mode     os.FileMode
+		replaced string
+		want     string
+		touched  bool
+	}{
+		{"Replaced", 0644, "package a\n\nfunc F() {}\n", "package a\n\nfunc F() {}\n", true},
+		{"Executable", 0755, "package a\n\nfunc F() {}\n", "package a\n\nfunc F() {}\n", true},
+		{"Read only", 0444, "package a\n\nfunc F() {}\n", "package a\n\nfunc F() {}\n", true},
+		{"Not changed", 0755, string(source), string(source), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "a.go")
+			if !assert.NoError(t, ioutil.WriteFile(path, source, 0644)) {
+				return
+			}
+			// WriteFile does not change mode of existing file and mode is masked by umask on creation
+			if !assert.NoError(t, os.Chmod(path, tt.mode)) {
+				return
+			}
+			old := time.Now().Add(-time.Hour).Truncate(time.Second)
+			if !assert.NoError(t, os.Chtimes(path, old, old)) {
+				return
+			}
+
+			err := writeSourceFile(&sourceFile{name: path, source: source}, []byte(tt.replaced))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, string(data))
+			}
+			info, err := os.Stat(path)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.mode, info.Mode().Perm())
+				assert.Equal(t, tt.touched, !info.ModTime().Equal(old))
+			}
+			// temporary file is removed
+			infos, err := ioutil.ReadDir(dir)
+			if assert.NoError(t, err) && assert.Len(t, infos, 1) {
+				assert.Equal(t, "a.go", infos[0].Name())
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic_NotExist(t *testing.T) {
+	dir := t.TempDir()
+	assert.Error(t, writeFileAtomic(filepath.Join(dir, "a.go"), []byte("package a\n")))
+	infos, err := ioutil.ReadDir(dir)
+	if assert.NoError(t, err) {
+		assert.Empty(t, infos)
+	}
+}